@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+)
+
+// salted hash of a room password
+type roomPassword struct {
+	salt []byte
+	hash []byte
+}
+
+// outgoing, a player waiting for the owner to let them in
+type PendingPlayer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func hashPassword(salt []byte, password string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(password))
+	return h.Sum(nil)
+}
+
+func newRoomPassword(password string) *roomPassword {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return &roomPassword{
+		salt: salt,
+		hash: hashPassword(salt, password),
+	}
+}
+
+// sets or clears (empty string) the room password, must run on the room goroutine
+func (r *Room) setPassword(password string) {
+	var pw *roomPassword
+	if password != "" {
+		pw = newRoomPassword(password)
+	}
+	r.settings.HasPassword = pw != nil
+	r.listingMu.Lock()
+	defer r.listingMu.Unlock()
+	r.password = pw
+}
+
+// safe to call from any goroutine
+func (r *Room) checkPassword(password string) bool {
+	r.listingMu.Lock()
+	defer r.listingMu.Unlock()
+	if r.password == nil {
+		return true
+	}
+	return subtle.ConstantTimeCompare(hashPassword(r.password.salt, password), r.password.hash) == 1
+}
+
+// joins the player, or queues them for the owner when the room is invite
+// only. returns true if the player joined
+func (r *Room) requestJoin(p *Player) bool {
+	if p.waiting == r || p.gone.Load() {
+		return false
+	}
+	if r.settings.InviteOnly {
+		r.pending = append(r.pending, p)
+		p.waiting = r
+		p.queue(noticeHelper("Waiting for the room owner to let you in"))
+		r.log.Info("player waiting for approval", "player", p.id)
+		return false
+	}
+	return r.admit(p)
+}
+
+// joins the player if there is space, otherwise puts them on the waitlist.
+// returns true if the player joined
+func (r *Room) admit(p *Player) bool {
+	if p.gone.Load() {
+		return false
+	}
+	if p.spectateOnJoin {
+		if r.spectatorsFull() {
+			p.queue(serverErrorHelper("There are no spectator spots left"))
+			return false
+		}
+		p.spectator = true
+		r.join(p)
+		return true
+	}
+	if r.full() {
+		r.waitlist = append(r.waitlist, p)
+		p.waiting = r
+		p.queue(noticeHelper(fmt.Sprintf("The room is full, you are number %d on the waitlist", len(r.waitlist))))
+		r.log.Info("player waitlisted", "player", p.id, "position", len(r.waitlist))
+		return false
+	}
+	r.join(p)
+	return true
+}
+
+// players that count towards MaxPlayers
+func (r *Room) playerCount() int {
+	return len(r.players) - r.spectatorCount()
+}
+
+func (r *Room) full() bool {
+	return r.settings.MaxPlayers > 0 && r.playerCount() >= r.settings.MaxPlayers
+}
+
+// lets waitlisted players in while there is space, returns true if anyone joined
+func (r *Room) admitFromWaitlist() bool {
+	joined := false
+	for len(r.waitlist) > 0 && !r.full() {
+		p := r.waitlist[0]
+		r.waitlist = r.waitlist[1:]
+		p.waiting = nil
+		if p.gone.Load() {
+			continue
+		}
+		r.join(p)
+		p.queue(noticeHelper("A spot opened up, you have joined the room"))
+		joined = true
+	}
+	return joined
+}
+
+func removeFromQueue(queue []*Player, id string) ([]*Player, *Player) {
+	for i, p := range queue {
+		if p.id == id {
+			return append(queue[:i], queue[i+1:]...), p
+		}
+	}
+	return queue, nil
+}
+
+// takes a player out of the pending queue or the waitlist, nil if they aren't
+// in either
+func (r *Room) removeWaiting(id string) *Player {
+	var p *Player
+	if r.pending, p = removeFromQueue(r.pending, id); p == nil {
+		r.waitlist, p = removeFromQueue(r.waitlist, id)
+	}
+	if p != nil {
+		p.waiting = nil
+	}
+	return p
+}
+
+// a room action from a queued player, all they can do is leave the queue
+func (r *Room) leaveQueue(ram RoomActionMessage) {
+	if ram.Leave == nil || !*ram.Leave {
+		r.sendErrorTo(ram.from, "You are not in this room yet")
+		return
+	}
+	r.removeWaiting(ram.from.id)
+	ram.from.queue(noticeHelper("You left the queue"))
+	r.log.Info("player left the queue", "player", ram.from.id)
+	r.broadcastRoomUpdate(false)
+}
+
+// takes a player out of the pending queue only, nil if they aren't in it
+func (r *Room) removePending(id string) *Player {
+	var p *Player
+	if r.pending, p = removeFromQueue(r.pending, id); p != nil {
+		p.waiting = nil
+	}
+	return p
+}
+
+// owner decision on a pending join request. returns true if the player joined
+func (r *Room) decidePending(owner *Player, id string, approve bool) bool {
+	if !r.isOwner(owner) {
+		r.sendErrorTo(owner, "Only the owner can approve join requests")
+		return false
+	}
+	p := r.removePending(id)
+	if p == nil {
+		r.sendErrorTo(owner, "No such join request")
+		return false
+	}
+	if !approve {
+		p.queue(noticeHelper("The room owner denied your request to join"))
+		r.log.Info("join request denied", "player", p.id)
+		return false
+	}
+	return r.admit(p)
+}
+
+// lets everyone in the pending queue in, used when invite only is turned off.
+// returns true if anyone joined
+func (r *Room) admitAllPending() bool {
+	joined := false
+	for len(r.pending) > 0 {
+		if r.admit(r.removePending(r.pending[0].id)) {
+			joined = true
+		}
+	}
+	return joined
+}
+
+func (r *Room) pendingList() []PendingPlayer {
+	list := []PendingPlayer{}
+	for _, p := range r.pending {
+		list = append(list, PendingPlayer{ID: p.id, Name: p.name})
+	}
+	return list
+}
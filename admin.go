@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var adminToken = flag.String("admin-token", "", "bearer token for the /admin api, the api is disabled when empty")
+
+// admin view of a room in the room list
+type AdminRoomSummary struct {
+	Code    string `json:"code"`
+	Players int    `json:"players"`
+	State   string `json:"state"`
+	Round   int    `json:"round"`
+}
+
+// admin view of a player in a room
+type AdminPlayer struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+// admin view of a single room
+type AdminRoomDetail struct {
+	AdminRoomSummary
+
+	PlayerList []AdminPlayer `json:"playerList"`
+	Teams      []TeamState   `json:"teams"`
+
+	// individual scores in free for all rooms
+	Leaderboard []LeaderboardEntry `json:"leaderboard"`
+
+	Chat []string `json:"chat"`
+}
+
+// incoming body for /admin/announce
+type AdminAnnouncement struct {
+	Message string `json:"message"`
+}
+
+// must run on the room goroutine
+func (r *Room) adminSummary() AdminRoomSummary {
+	snap := r.game.snapshot(false)
+	return AdminRoomSummary{
+		Code:    r.code,
+		Players: len(r.players),
+		State:   RoundState(snap.State).String(),
+		Round:   snap.Round,
+	}
+}
+
+// must run on the room goroutine
+func (r *Room) adminDetail() AdminRoomDetail {
+	d := AdminRoomDetail{
+		AdminRoomSummary: r.adminSummary(),
+		PlayerList:       []AdminPlayer{},
+		Teams:            []TeamState{},
+		Leaderboard:      []LeaderboardEntry{},
+		Chat:             append([]string{}, r.chat...),
+	}
+	snap := r.game.snapshot(true)
+	if snap.Teams != nil {
+		d.Teams = *snap.Teams
+	}
+	if snap.Leaderboard != nil {
+		d.Leaderboard = *snap.Leaderboard
+	}
+	for p, n := range r.players {
+		d.PlayerList = append(d.PlayerList, AdminPlayer{ID: p.id, Name: p.roomname, Number: n})
+	}
+	return d
+}
+
+// wraps an admin handler with bearer token auth
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if *adminToken == "" {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(*adminToken)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// looks up a room on the hub goroutine
+func (h *Hub) lookupRoom(code string) *Room {
+	var room *Room
+	h.do(func(h *Hub) {
+		room = h.rooms[code]
+	})
+	return room
+}
+
+// registers the health checks and the admin api
+func registerAdminRoutes(mux *http.ServeMux, hub *Hub) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !hub.ready.Load() {
+			http.Error(w, "hub not running", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+
+	mux.HandleFunc("GET /admin/rooms", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		rooms := []*Room{}
+		hub.do(func(h *Hub) {
+			for _, room := range h.rooms {
+				rooms = append(rooms, room)
+			}
+		})
+		list := []AdminRoomSummary{}
+		for _, room := range rooms {
+			room.do(func(r *Room) {
+				list = append(list, r.adminSummary())
+			})
+		}
+		writeJSON(w, http.StatusOK, list)
+	}))
+
+	mux.HandleFunc("GET /admin/rooms/{code}", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		room := hub.lookupRoom(normalizeRoomCode(r.PathValue("code")))
+		var detail AdminRoomDetail
+		if room == nil || !room.do(func(r *Room) { detail = r.adminDetail() }) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, detail)
+	}))
+
+	mux.HandleFunc("DELETE /admin/rooms/{code}", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		found := false
+		code := normalizeRoomCode(r.PathValue("code"))
+		hub.do(func(h *Hub) {
+			if room, in := h.rooms[code]; in {
+				found = true
+				h.closeRoom(room, "This room was closed by an admin")
+			}
+		})
+		if !found {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	mux.HandleFunc("POST /admin/players/{id}/kick", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		found := false
+		hub.do(func(h *Hub) {
+			if p := h.findPlayer(r.PathValue("id")); p != nil {
+				found = true
+				p.logger().Info("player kicked by admin")
+				p.queue(noticeHelper("You were kicked by an admin"))
+				// writePump sends the notice and hangs up, readPump then fails
+				// and unregisters the player
+				p.close()
+			}
+		})
+		if !found {
+			http.Error(w, "Player not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	mux.HandleFunc("POST /admin/announce", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		a := AdminAnnouncement{}
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil || a.Message == "" {
+			http.Error(w, "Bad announcement format", http.StatusBadRequest)
+			return
+		}
+		hub.do(func(h *Hub) {
+			h.announce(a.Message)
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
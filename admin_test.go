@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminRooms(t *testing.T) {
+	*adminToken = "secret"
+	defer func() { *adminToken = "" }()
+
+	hub := newHub()
+	go hub.run()
+	owner := &Player{id: "owner"}
+	hub.do(func(h *Hub) { h.createRoom(owner, defaultRoomSettings()) })
+	code := owner.room.code
+
+	mux := http.NewServeMux()
+	registerAdminRoutes(mux, hub)
+	request := func(method string, path string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("GET", "/readyz", ""); w.Code != http.StatusOK {
+		t.Fatalf("Hub should be ready, got %d", w.Code)
+	}
+	if w := request("GET", "/admin/rooms", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Bad token should be rejected, got %d", w.Code)
+	}
+
+	// codes are case insensitive like everywhere else
+	w := request("GET", "/admin/rooms/"+strings.ToLower(code), "secret")
+	detail := AdminRoomDetail{}
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Could not inspect room: %d %v", w.Code, err)
+	}
+	if detail.Players != 1 || detail.State != "lobby" {
+		t.Errorf("Unexpected room detail %+v", detail)
+	}
+
+	if w := request("DELETE", "/admin/rooms/"+strings.ToLower(code), "secret"); w.Code != http.StatusNoContent {
+		t.Fatalf("Could not close room, got %d", w.Code)
+	}
+	if w := request("GET", "/admin/rooms/"+code, "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("Closed room should be gone, got %d", w.Code)
+	}
+}
+
+func TestAdminKick(t *testing.T) {
+	*adminToken = "secret"
+	defer func() { *adminToken = "" }()
+
+	hub := newHub()
+	go hub.run()
+	p := &Player{id: "troll", send: make(chan OutgoingMessage, 256), done: make(chan struct{})}
+	hub.do(func(h *Hub) { h.players[p] = true })
+
+	mux := http.NewServeMux()
+	registerAdminRoutes(mux, hub)
+	req := httptest.NewRequest("POST", "/admin/players/troll/kick", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Could not kick player, got %d", w.Code)
+	}
+
+	// the notice stays queued for writePump to send before hanging up
+	select {
+	case <-p.done:
+	default:
+		t.Fatal("Kick should tell writePump to hang up")
+	}
+	if len(p.send) != 1 {
+		t.Fatalf("Kick notice should be queued, got %d messages", len(p.send))
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var allowedOrigins = flag.String("allowed-origins", "", "comma separated origins allowed to open websockets, * allows any, empty only allows the same host")
+var authSecret = flag.String("auth-secret", "", "HMAC secret used to verify HS256 player tokens")
+var requireAuth = flag.Bool("require-auth", false, "reject websocket connections without a valid token")
+
+var (
+	errMissingToken = errors.New("missing token")
+	errBadToken     = errors.New("malformed token")
+	errBadSignature = errors.New("bad token signature")
+	errExpiredToken = errors.New("token expired")
+)
+
+// external identity attached to a player by a verified token
+type Identity struct {
+	// subject, the stable external user id
+	Subject string `json:"sub"`
+
+	// display name, optional
+	Name string `json:"name"`
+
+	// expiry in unix seconds, 0 means no expiry
+	Expires int64 `json:"exp"`
+}
+
+// websocket origin check against the -allowed-origins allowlist
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser, origin checks don't apply
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.TrimSpace(*allowedOrigins) == "" {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range strings.Split(*allowedOrigins, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// token from the token query parameter or a bearer Authorization header
+func tokenFromRequest(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// verifies an HS256 JWT signed with secret and returns its identity
+func verifyToken(token string, secret []byte, now time.Time) (*Identity, error) {
+	if token == "" {
+		return nil, errMissingToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errBadToken
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := decodeTokenPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, errBadToken
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errBadSignature
+	}
+
+	id := Identity{}
+	if err := decodeTokenPart(parts[1], &id); err != nil || id.Subject == "" {
+		return nil, errBadToken
+	}
+	if id.Expires != 0 && now.Unix() >= id.Expires {
+		return nil, errExpiredToken
+	}
+	return &id, nil
+}
+
+func decodeTokenPart(part string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// checks the upgrade request's token against the auth flags, a nil identity
+// with a nil error means an anonymous player
+func authenticate(r *http.Request) (*Identity, error) {
+	token := tokenFromRequest(r)
+	if *authSecret == "" || token == "" {
+		if *requireAuth {
+			return nil, errMissingToken
+		}
+		return nil, nil
+	}
+	return verifyToken(token, []byte(*authSecret), time.Now())
+}
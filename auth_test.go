@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signTestToken(header string, claims string, secret string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyToken(t *testing.T) {
+	now := time.Unix(1000, 0)
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+
+	id, err := verifyToken(signTestToken(hs256, `{"sub":"u1","name":"Ann","exp":2000}`, "key"), []byte("key"), now)
+	if err != nil || id.Subject != "u1" || id.Name != "Ann" {
+		t.Fatalf("Valid token was rejected: %v %+v", err, id)
+	}
+
+	cases := map[string]struct {
+		token string
+		want  error
+	}{
+		"wrong secret": {signTestToken(hs256, `{"sub":"u1"}`, "other"), errBadSignature},
+		"expired":      {signTestToken(hs256, `{"sub":"u1","exp":1000}`, "key"), errExpiredToken},
+		"alg none":     {signTestToken(`{"alg":"none"}`, `{"sub":"u1"}`, "key"), errBadToken},
+		"no subject":   {signTestToken(hs256, `{"name":"Ann"}`, "key"), errBadToken},
+		"garbage":      {"abc", errBadToken},
+	}
+	for name, c := range cases {
+		if _, err := verifyToken(c.token, []byte("key"), now); err != c.want {
+			t.Errorf("%s: expected %v, got %v", name, c.want, err)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	defer func() { *allowedOrigins = "" }()
+	req := httptest.NewRequest("GET", "http://game.example/ws", nil)
+
+	req.Header.Set("Origin", "http://evil.example")
+	if checkOrigin(req) {
+		t.Errorf("Cross origin request allowed without an allowlist")
+	}
+
+	*allowedOrigins = "http://localhost:3000, http://evil.example"
+	if !checkOrigin(req) {
+		t.Errorf("Allowlisted origin was rejected")
+	}
+
+	req.Header.Set("Origin", "http://other.example")
+	if checkOrigin(req) {
+		t.Errorf("Origin outside the allowlist was accepted")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+)
+
+const BoardMode = "board"
+
+// most categories on a board
+const BoardCategories = 5
+
+// points for a board question by difficulty, easiest first
+var BoardValues = []int{100, 200, 300}
+
+var errEmptyBoard = errors.New("There are no questions for the board")
+
+// incoming, a board question by category and value
+type BoardPick struct {
+	Category string `json:"category"`
+	Value    int    `json:"value"`
+}
+
+// outgoing
+type BoardState struct {
+	Categories []BoardCategory `json:"categories"`
+
+	// team picking the next question
+	Control string `json:"control"`
+
+	// question being played, nil between rounds
+	Picked *BoardPick `json:"picked"`
+}
+
+type BoardCategory struct {
+	Name  string      `json:"name"`
+	Cells []BoardCell `json:"cells"`
+}
+
+type BoardCell struct {
+	Value int  `json:"value"`
+	Used  bool `json:"used"`
+}
+
+type boardCell struct {
+	question *Question
+	value    int
+	used     bool
+}
+
+type boardColumn struct {
+	category string
+	cells    []*boardCell
+}
+
+// BoardGame is team trivia played off a board of categories and values. The
+// team in control picks the next question during limbo, each team's answer
+// wins or loses the question's value and the first team right takes control.
+type BoardGame struct {
+	*TriviaGame
+
+	board []*boardColumn
+
+	// index of the team picking the next question
+	control int
+
+	// cell for the current round, nil until picked
+	picked *boardCell
+}
+
+func init() {
+	registerGameMode(BoardMode, func(h gameHooks) GameMode {
+		g := newTriviaGameWithHooks(h)
+		return newBoardGame(g)
+	})
+}
+
+func newBoardGame(g *TriviaGame) *BoardGame {
+	b := &BoardGame{TriviaGame: g}
+	g.nextQuestion = b.nextQuestion
+	g.scorer = b.scoreBoard
+	g.onRoundEnd = b.finishQuestion
+	g.extendSnapshot = b.addBoardState
+	return b
+}
+
+// sets up the board and waits in limbo for the first pick
+func (b *BoardGame) start(players []*Player) error {
+	if err := b.prepareTeams(players); err != nil {
+		return err
+	}
+	b.resetGame()
+	b.buildBoard()
+	if b.cellsLeft() == 0 {
+		return errEmptyBoard
+	}
+	b.control = 0
+	b.picked = nil
+	b.question = nil
+	b.setState(InLimbo)
+	b.timer.Reset(b.limboTime)
+	return nil
+}
+
+// one question per category and difficulty, skipping any the bank doesn't have
+func (b *BoardGame) buildBoard() {
+	b.board = nil
+	for _, category := range b.bank.categories() {
+		if len(b.board) == BoardCategories {
+			break
+		}
+		column := &boardColumn{category: category}
+		for i, value := range BoardValues {
+			q := b.bank.pick(category, i+1, b.asked)
+			if q == nil {
+				continue
+			}
+			b.asked[q] = true
+			column.cells = append(column.cells, &boardCell{question: q, value: value})
+		}
+		if len(column.cells) > 0 {
+			b.board = append(b.board, column)
+		}
+	}
+}
+
+func (b *BoardGame) cellsLeft() int {
+	n := 0
+	for _, column := range b.board {
+		for _, cell := range column.cells {
+			if !cell.used {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (b *BoardGame) handleAction(tgam *TriviaGameActionMessage) {
+	switch {
+	case b.state == InLimbo && tgam.Pick != nil:
+		b.pick(tgam.from, *tgam.Pick)
+	case b.state == InRound && tgam.Guess != nil && b.teamAnswer == TeamAnswerEach && b.teamAnswered(b.teamOf(tgam.from)):
+		b.roomErrorSender(tgam.from, "Your team already answered")
+	default:
+		b.TriviaGame.handleAction(tgam)
+	}
+}
+
+// controlling team picks a question, the round starts right away
+func (b *BoardGame) pick(p *Player, bp BoardPick) {
+	if b.board == nil || b.teamOf(p) != b.teams[b.control] || !b.speaksForTeam(p) {
+		b.roomErrorSender(p, "It's not your team's turn to pick")
+		return
+	}
+	cell := b.find(bp)
+	if cell == nil {
+		b.roomErrorSender(p, "That question isn't on the board")
+		return
+	}
+	b.picked = cell
+	b.goToRoundFromLimbo()
+	b.broadcast(false)
+}
+
+func (b *BoardGame) find(bp BoardPick) *boardCell {
+	for _, column := range b.board {
+		if column.category != bp.Category {
+			continue
+		}
+		for _, cell := range column.cells {
+			if cell.value == bp.Value && !cell.used {
+				return cell
+			}
+		}
+	}
+	return nil
+}
+
+// has anyone on the team answered this round, when each player answers for
+// themselves only the first answer counts
+func (b *BoardGame) teamAnswered(team *Team) bool {
+	if team == nil {
+		return false
+	}
+	for member := range team.members {
+		if _, in := b.roundVotes[member]; in {
+			return true
+		}
+	}
+	return false
+}
+
+// the picked question, or the first one left when the team ran out of time
+func (b *BoardGame) nextQuestion() *Question {
+	if b.picked == nil {
+		for _, column := range b.board {
+			for _, cell := range column.cells {
+				if b.picked == nil && !cell.used {
+					b.picked = cell
+				}
+			}
+		}
+		b.log.Info("no pick in time, took the next question on the board", "round", b.round)
+	}
+	b.picked.used = true
+	return b.picked.question
+}
+
+// the answer that counts for each team, in the order they came in
+func (b *BoardGame) boardAnswers() []*Player {
+	answers := []*Player{}
+	answered := make(map[*Team]bool)
+	for _, p := range b.guessOrder {
+		team := b.teamOf(p)
+		if team == nil || answered[team] {
+			continue
+		}
+		if b.teamAnswer != TeamAnswerEach && b.teamAnswerOf(team) != p {
+			continue
+		}
+		answered[team] = true
+		answers = append(answers, p)
+	}
+	return answers
+}
+
+// each team's answer wins or loses the question's value, less any hints for
+// right answers
+func (b *BoardGame) scoreBoard() {
+	if b.picked == nil {
+		return
+	}
+	took := false
+	for _, p := range b.boardAnswers() {
+		team := b.teamOf(p)
+		if !b.correctGuess(p) {
+			team.score -= b.picked.value
+			b.roundPoints[p] = -b.picked.value
+			continue
+		}
+		// hints that were out cost points like they do everywhere else
+		points := max(b.picked.value-HintPenalty*b.guessHints[p], 0)
+		team.score += points
+		b.roundPoints[p] = points
+		if !took {
+			for i := range b.teams {
+				if b.teams[i] == team {
+					b.control = i
+				}
+			}
+			took = true
+		}
+	}
+}
+
+// clears the pick and ends the game once the board is empty
+func (b *BoardGame) finishQuestion() {
+	b.picked = nil
+	if b.cellsLeft() == 0 {
+		b.endGame()
+	}
+}
+
+func (b *BoardGame) addBoardState(tsum *TriviaStateUpdateMessage) {
+	tsum.Mode = BoardMode
+	if b.board == nil {
+		return
+	}
+	bs := BoardState{Categories: []BoardCategory{}}
+	for _, column := range b.board {
+		bc := BoardCategory{Name: column.category, Cells: []BoardCell{}}
+		for _, cell := range column.cells {
+			bc.Cells = append(bc.Cells, BoardCell{Value: cell.value, Used: cell.used})
+			if cell == b.picked {
+				bs.Picked = &BoardPick{Category: column.category, Value: cell.value}
+			}
+		}
+		bs.Categories = append(bs.Categories, bc)
+	}
+	if b.control < len(b.teams) {
+		bs.Control = b.teams[b.control].name
+	}
+	tsum.Board = &bs
+}
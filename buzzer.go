@@ -0,0 +1,203 @@
+package main
+
+import (
+	"time"
+)
+
+const BuzzerMode = "buzzer"
+
+// how long a player who buzzed in has to answer
+const DefaultBuzzerAnswerTime = 5 * time.Second
+
+// outgoing, buzzer state during a round
+type BuzzerState struct {
+	// players in the order they buzzed in
+	Order []string `json:"order"`
+
+	// player holding the answer window, nil when the question is open
+	Answering *string `json:"answering"`
+
+	// players who can't buzz again this round
+	LockedOut []string `json:"lockedOut"`
+}
+
+// BuzzerGame is team trivia where the first player to buzz gets to answer
+// alone. A wrong answer locks their team out and reopens the question.
+type BuzzerGame struct {
+	*TriviaGame
+
+	// players in the order they buzzed this round
+	buzzOrder []*Player
+
+	// player holding the answer window, nil when the question is open
+	answering *Player
+
+	// players who can't buzz again this round
+	lockedOut map[*Player]bool
+
+	// time left before the last deadline when the answer window opened
+	remaining time.Duration
+
+	// how long the answer window lasts
+	answerTime time.Duration
+}
+
+func init() {
+	registerGameMode(BuzzerMode, func(h gameHooks) GameMode {
+		g := newTriviaGameWithHooks(h)
+		return newBuzzerGame(g)
+	})
+}
+
+func newBuzzerGame(g *TriviaGame) *BuzzerGame {
+	b := &BuzzerGame{
+		TriviaGame: g,
+		lockedOut:  make(map[*Player]bool),
+		answerTime: DefaultBuzzerAnswerTime,
+	}
+	g.onRoundStart = b.resetBuzzer
+	g.extendSnapshot = b.addBuzzerState
+	return b
+}
+
+func (b *BuzzerGame) resetBuzzer() {
+	b.buzzOrder = nil
+	b.answering = nil
+	b.lockedOut = make(map[*Player]bool)
+}
+
+func (b *BuzzerGame) handleAction(tgam *TriviaGameActionMessage) {
+	if b.state != InRound {
+		b.TriviaGame.handleAction(tgam)
+		return
+	}
+	if tgam.Buzz != nil && *tgam.Buzz {
+		b.buzz(tgam.from)
+		return
+	}
+	if tgam.Guess != nil {
+		b.answer(tgam.from, *tgam.Guess)
+		return
+	}
+	if tgam.Lifeline != nil && b.answering != nil {
+		b.roomErrorSender(tgam.from, "Someone else is answering")
+		return
+	}
+	b.TriviaGame.handleAction(tgam)
+}
+
+func (b *BuzzerGame) handleTimer() {
+	if b.state == InRound && b.answering != nil {
+		// answer window ran out, same as a wrong answer
+		b.lockOut(b.answering)
+		b.reopen()
+		return
+	}
+	b.TriviaGame.handleTimer()
+}
+
+// first buzz wins the answer window, arrival order is the room loop order.
+// with captains in charge only they can buzz for their team
+func (b *BuzzerGame) buzz(p *Player) {
+	if b.teamOf(p) == nil {
+		b.roomErrorSender(p, "Pick a team first")
+		return
+	}
+	if !b.speaksForTeam(p) {
+		b.roomErrorSender(p, "Only your captain can buzz")
+		return
+	}
+	if b.lockedOut[p] {
+		b.roomErrorSender(p, "You are locked out this round")
+		return
+	}
+	if b.answering != nil {
+		b.roomErrorSender(p, "Someone else is answering")
+		return
+	}
+	b.buzzOrder = append(b.buzzOrder, p)
+	b.answering = p
+	b.remaining = time.Until(b.roundDeadline())
+	b.timer.Reset(b.answerTime)
+	b.broadcast(false)
+}
+
+func (b *BuzzerGame) answer(p *Player, guess string) {
+	if b.answering != p {
+		b.roomErrorSender(p, "Buzz in before answering")
+		return
+	}
+	b.guess(p, guess)
+	if b.correctGuess(p) {
+		// round over, scoring picks up the recorded guess
+		b.answering = nil
+		b.goToLimboFromRound()
+		b.broadcast(false)
+		return
+	}
+	b.lockOut(p)
+	b.reopen()
+}
+
+// locks out the player's whole team
+func (b *BuzzerGame) lockOut(p *Player) {
+	b.lockedOut[p] = true
+	if team := b.teamOf(p); team != nil {
+		for member := range team.members {
+			b.lockedOut[member] = true
+		}
+	}
+}
+
+// gives the question back to everyone who isn't locked out, or ends the round
+// when every team is
+func (b *BuzzerGame) reopen() {
+	b.answering = nil
+	open := false
+	for _, team := range b.teams {
+		for member := range team.members {
+			if !b.lockedOut[member] {
+				open = true
+			}
+		}
+	}
+	if !open || b.remaining <= 0 {
+		b.goToLimboFromRound()
+		b.broadcast(false)
+		return
+	}
+	// the answer window doesn't eat into the round time, every deadline moves
+	// back by however long it was open
+	b.roundStart = b.roundStart.Add(b.remaining - time.Until(b.roundDeadline()))
+	b.timer.Reset(b.remaining)
+	b.broadcast(false)
+}
+
+func (b *BuzzerGame) addBuzzerState(tsum *TriviaStateUpdateMessage) {
+	if b.state == InLobby {
+		return
+	}
+	bs := BuzzerState{
+		Order:     []string{},
+		LockedOut: []string{},
+	}
+	for _, p := range b.buzzOrder {
+		bs.Order = append(bs.Order, p.roomname)
+	}
+	if b.answering != nil {
+		bs.Answering = &b.answering.roomname
+	}
+	for p := range b.lockedOut {
+		bs.LockedOut = append(bs.LockedOut, p.roomname)
+	}
+	tsum.Buzzer = &bs
+	tsum.Mode = BuzzerMode
+}
+
+func (b *BuzzerGame) removePlayer(p *Player) {
+	b.TriviaGame.removePlayer(p)
+	delete(b.lockedOut, p)
+	if b.answering == p {
+		b.reopen()
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// captains only have powers when teams answer through them. the captain's vote
+// is the team answer, and they pick board questions and use lifelines for the
+// team
+
+var errNotOnTeam = errors.New("That player isn't on a team")
+
+// can p act for their team, anyone can unless captains are in charge
+func (t *TriviaGame) speaksForTeam(p *Player) bool {
+	team := t.teamOf(p)
+	if team == nil {
+		return false
+	}
+	return t.teamAnswer != TeamAnswerCaptain || team.captain() == p
+}
+
+// vote for a teammate as captain, more than half of the team makes them captain
+func (t *TriviaGame) elect(p *Player, name string) {
+	team := t.teamOf(p)
+	if team == nil {
+		t.roomErrorSender(p, "Pick a team first")
+		return
+	}
+	var candidate *Player
+	for member := range team.members {
+		if member.roomname == name {
+			candidate = member
+		}
+	}
+	if candidate == nil {
+		t.roomErrorSender(p, fmt.Sprintf("%s is not on your team", name))
+		return
+	}
+	team.elections[p] = candidate
+	votes := 0
+	for _, c := range team.elections {
+		if c == candidate {
+			votes++
+		}
+	}
+	if votes*2 > len(team.members) && team.chosen != candidate {
+		team.chosen = candidate
+		t.log.Info("captain elected", "team", team.name, "player", candidate.id)
+		t.broadcast(true)
+	}
+}
+
+func (t *TriviaGame) assignCaptain(p *Player) error {
+	team := t.teamOf(p)
+	if team == nil {
+		return errNotOnTeam
+	}
+	team.chosen = p
+	team.elections = make(map[*Player]*Player)
+	t.log.Info("captain assigned", "team", team.name, "player", p.id)
+	return nil
+}
+
+// owner makes a player their team's captain, returns true if it worked
+func (r *Room) assignCaptain(ram RoomActionMessage) bool {
+	if ram.Captain == nil {
+		return false
+	}
+	if !r.isOwner(ram.from) {
+		r.sendErrorTo(ram.from, "Only the owner can assign captains")
+		return false
+	}
+	assigner, ok := r.game.(captainAssigner)
+	if !ok {
+		r.sendErrorTo(ram.from, "This game mode has no teams")
+		return false
+	}
+	p := r.findByRoomName(*ram.Captain)
+	if p == nil {
+		r.sendErrorTo(ram.from, fmt.Sprintf("%s is not in this room", *ram.Captain))
+		return false
+	}
+	if err := assigner.assignCaptain(p); err != nil {
+		r.sendErrorTo(ram.from, err.Error())
+		return false
+	}
+	r.writeSystemChat(fmt.Sprintf("%s is now captain", p.roomname))
+	return true
+}
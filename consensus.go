@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+)
+
+// how a team's votes become the team's answer
+const (
+	TeamAnswerEach     = "each"     // every correct teammate scores
+	TeamAnswerMajority = "majority" // most voted answer, earliest vote breaks ties
+	TeamAnswerCaptain  = "captain"  // the captain's vote is the answer, see captains.go
+	TeamAnswerAny      = "any"      // team scores once if anyone is right
+)
+
+var teamAnswerModes = map[string]bool{
+	TeamAnswerEach:     true,
+	TeamAnswerMajority: true,
+	TeamAnswerCaptain:  true,
+	TeamAnswerAny:      true,
+}
+
+// outgoing, a teammate's current vote
+type VoteState struct {
+	Player string `json:"player"`
+	Guess  string `json:"guess"`
+}
+
+// votes are only final when every vote counts on its own
+func (t *TriviaGame) votesCanChange() bool {
+	return !t.freeForAll && (t.teamAnswer == TeamAnswerMajority || t.teamAnswer == TeamAnswerCaptain)
+}
+
+// the vote that stands for the team's answer, nil if the team has none
+func (t *TriviaGame) teamAnswerOf(team *Team) *Player {
+	switch t.teamAnswer {
+	case TeamAnswerCaptain:
+		if c := team.captain(); c != nil {
+			if _, in := t.roundVotes[c]; in {
+				return c
+			}
+		}
+		return nil
+	case TeamAnswerAny:
+		var first *Player
+		for _, p := range t.guessOrder {
+			if !team.members[p] {
+				continue
+			}
+			if t.correctGuess(p) {
+				return p
+			}
+			if first == nil {
+				first = p
+			}
+		}
+		return first
+	}
+
+	// majority, answers compare like guesses do
+	counts := make(map[string]int)
+	earliest := make(map[string]*Player)
+	for _, p := range t.guessOrder {
+		if !team.members[p] {
+			continue
+		}
+		answer := strings.ToLower(strings.TrimSpace(t.roundVotes[p]))
+		counts[answer]++
+		if e := earliest[answer]; e == nil || t.guessTimes[p] < t.guessTimes[e] {
+			earliest[answer] = p
+		}
+	}
+	var best *Player
+	bestCount := 0
+	for answer, count := range counts {
+		p := earliest[answer]
+		if count > bestCount || (count == bestCount && t.guessTimes[p] < t.guessTimes[best]) {
+			best, bestCount = p, count
+		}
+	}
+	return best
+}
+
+// one answer per team, timed by the vote that stands for it
+func (t *TriviaGame) scoreTeamAnswers() {
+	for _, team := range t.teams {
+		p := t.teamAnswerOf(team)
+		if p == nil || !t.correctGuess(p) {
+			continue
+		}
+		points := t.pointsFor(p)
+		t.roundPoints[p] = points
+		team.score += points
+	}
+}
+
+// shows a team its own votes as they come in, other teams see them on the reveal
+func (t *TriviaGame) sendTeamVotes(p *Player) {
+	if t.debugMode || t.freeForAll || t.teamAnswer == TeamAnswerEach || t.roomGameUpdateSender == nil {
+		return
+	}
+	team := t.teamOf(p)
+	if team == nil {
+		return
+	}
+	votes := []VoteState{}
+	for _, member := range t.guessOrder {
+		if team.members[member] {
+			votes = append(votes, VoteState{Player: member.roomname, Guess: t.roundVotes[member]})
+		}
+	}
+	for member := range team.members {
+		tsum := t.snapshotFor(member, false)
+		tsum.TeamVotes = &votes
+		t.roomGameUpdateSender(member, tsum)
+	}
+}
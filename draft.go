@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+// categories offered to the drafting team
+const DraftChoices = 3
+
+// outgoing, a drafted category
+type DraftPick struct {
+	Round    int    `json:"round"`
+	Team     string `json:"team"`
+	Category string `json:"category"`
+}
+
+// outgoing
+type DraftState struct {
+	// teams in drafting order
+	Order []string `json:"order"`
+
+	// team picking now and what it can pick from, empty between drafts
+	Turn    string   `json:"turn"`
+	Offered []string `json:"offered"`
+
+	// picked so far, nothing until the team picks
+	Picked string `json:"picked"`
+
+	Picks []DraftPick `json:"picks"`
+}
+
+// teams with players, in team order
+func (t *TriviaGame) draftOrder() []*Team {
+	order := []*Team{}
+	for _, team := range t.teams {
+		if len(team.members) > 0 {
+			order = append(order, team)
+		}
+	}
+	return order
+}
+
+// offers the next team a few categories, modes that choose their own
+// questions don't draft
+func (t *TriviaGame) openDraft() {
+	t.draftTeam = nil
+	if !t.draft || t.freeForAll || t.nextQuestion != nil {
+		return
+	}
+	order := t.draftOrder()
+	if len(order) == 0 {
+		return
+	}
+	categories := append([]string{}, t.bank.categories()...)
+	if len(categories) == 0 {
+		return
+	}
+	rand.Shuffle(len(categories), func(i, j int) { categories[i], categories[j] = categories[j], categories[i] })
+	t.draftTeam = order[len(t.draftPicks)%len(order)]
+	t.draftOffer = categories[:min(DraftChoices, len(categories))]
+	t.draftPick = ""
+}
+
+// the drafting team picks, or changes its pick until limbo is over
+func (t *TriviaGame) draftCategory(p *Player, category string) {
+	if t.draftTeam == nil || t.teamOf(p) != t.draftTeam {
+		t.roomErrorSender(p, "It's not your team's turn to draft")
+		return
+	}
+	if !t.speaksForTeam(p) {
+		t.roomErrorSender(p, "Only your captain can draft")
+		return
+	}
+	for _, offered := range t.draftOffer {
+		if offered == category {
+			t.draftPick = category
+			t.broadcast(false)
+			return
+		}
+	}
+	t.roomErrorSender(p, fmt.Sprintf("%s isn't on offer", category))
+}
+
+// closes the draft, the first offered category when nobody picked. empty when
+// there was no draft
+func (t *TriviaGame) takeDraftPick() string {
+	if t.draftTeam == nil {
+		return ""
+	}
+	category := t.draftPick
+	if category == "" {
+		category = t.draftOffer[0]
+	}
+	t.draftPicks = append(t.draftPicks, DraftPick{Round: t.round, Team: t.draftTeam.name, Category: category})
+	t.log.Info("category drafted", "team", t.draftTeam.name, "category", category, "default", t.draftPick == "")
+	t.draftTeam = nil
+	t.draftOffer = nil
+	t.draftPick = ""
+	return category
+}
+
+func (t *TriviaGame) draftState() DraftState {
+	ds := DraftState{
+		Order:   []string{},
+		Offered: []string{},
+		Picks:   []DraftPick{},
+	}
+	for _, team := range t.draftOrder() {
+		ds.Order = append(ds.Order, team.name)
+	}
+	if t.draftTeam != nil {
+		ds.Turn = t.draftTeam.name
+		ds.Offered = append(ds.Offered, t.draftOffer...)
+		ds.Picked = t.draftPick
+	}
+	ds.Picks = append(ds.Picks, t.draftPicks...)
+	return ds
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+const EliminationMode = "elimination"
+
+// round time lost every round in elimination, down to the minimum
+const (
+	EliminationRoundStep    = time.Second
+	EliminationMinRoundTime = 4 * time.Second
+)
+
+var errTooFewPlayers = errors.New("Elimination needs at least two players")
+
+// outgoing, whether a player is still in the game
+type AliveState struct {
+	Player string `json:"player"`
+	Alive  bool   `json:"alive"`
+}
+
+// EliminationGame is free for all trivia where a wrong or missing answer
+// knocks the player out to the spectators. Last player standing wins.
+type EliminationGame struct {
+	*TriviaGame
+
+	// players who started the game, in join order
+	players []*Player
+
+	// players still in
+	alive map[*Player]bool
+
+	// last player standing, nil while the game runs
+	winner *Player
+
+	// moves eliminated players to the spectators and back
+	spectate func(*Player, bool)
+}
+
+func init() {
+	registerGameMode(EliminationMode, func(h gameHooks) GameMode {
+		g := newTriviaGameWithHooks(h)
+		return newEliminationGame(g, h.spectate)
+	})
+}
+
+func newEliminationGame(g *TriviaGame, spectate func(*Player, bool)) *EliminationGame {
+	g.freeForAll = true
+	e := &EliminationGame{
+		TriviaGame: g,
+		alive:      make(map[*Player]bool),
+		spectate:   spectate,
+	}
+	g.onRoundStart = e.shortenRound
+	g.onRoundEnd = e.eliminate
+	g.extendSnapshot = e.addAliveState
+	return e
+}
+
+func (e *EliminationGame) start(players []*Player) error {
+	if len(players) < 2 {
+		return errTooFewPlayers
+	}
+	e.players = players
+	e.alive = make(map[*Player]bool)
+	for _, p := range players {
+		e.alive[p] = true
+	}
+	e.winner = nil
+	e.roundTime = DefaultTriviaRoundTime * time.Second
+	e.startGame()
+	e.seedScores(players)
+	return nil
+}
+
+func (e *EliminationGame) handleAction(tgam *TriviaGameActionMessage) {
+	if e.state == InRound && tgam.Guess != nil && !e.alive[tgam.from] {
+		e.roomErrorSender(tgam.from, "You are not in this game")
+		return
+	}
+	e.TriviaGame.handleAction(tgam)
+}
+
+// every round after the first is a step shorter
+func (e *EliminationGame) shortenRound() {
+	e.roundTime = max(DefaultTriviaRoundTime*time.Second-time.Duration(e.round-1)*EliminationRoundStep, EliminationMinRoundTime)
+	e.timer.Reset(e.roundTime)
+}
+
+// knocks out everyone who didn't answer correctly. if nobody got it right the
+// round doesn't count
+func (e *EliminationGame) eliminate() {
+	out := []*Player{}
+	for p := range e.alive {
+		if !e.correctGuess(p) {
+			out = append(out, p)
+		}
+	}
+	if len(out) == len(e.alive) {
+		e.log.Info("nobody answered correctly, no one eliminated", "round", e.round)
+		return
+	}
+	for _, p := range out {
+		delete(e.alive, p)
+		e.spectate(p, true)
+		e.log.Info("player eliminated", "player", p.id, "round", e.round)
+	}
+	e.checkWinner()
+}
+
+// ends the game once one player is left
+func (e *EliminationGame) checkWinner() bool {
+	if e.state == InLobby || len(e.alive) > 1 {
+		return false
+	}
+	for p := range e.alive {
+		e.winner = p
+	}
+	e.endGame()
+	// eliminated players get to play the next game
+	for _, p := range e.players {
+		if !e.alive[p] {
+			e.spectate(p, false)
+		}
+	}
+	if e.winner != nil {
+		e.log.Info("elimination game won", "player", e.winner.id, "rounds", e.round)
+	}
+	return true
+}
+
+func (e *EliminationGame) removePlayer(p *Player) {
+	e.TriviaGame.removePlayer(p)
+	delete(e.alive, p)
+	for i, pl := range e.players {
+		if pl == p {
+			e.players = append(e.players[:i], e.players[i+1:]...)
+			break
+		}
+	}
+	if e.checkWinner() {
+		e.broadcast(true)
+	}
+}
+
+func (e *EliminationGame) addAliveState(tsum *TriviaStateUpdateMessage) {
+	tsum.Mode = EliminationMode
+	alive := []AliveState{}
+	for _, p := range e.players {
+		alive = append(alive, AliveState{Player: p.roomname, Alive: e.alive[p]})
+	}
+	tsum.Alive = &alive
+	if e.winner != nil {
+		tsum.Winner = &e.winner.roomname
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// GameMode is a game a Room can run. The room owns the goroutine and drives
+// the mode, calling into it for player actions and timer ticks.
+type GameMode interface {
+	// applies room settings, only called in the lobby
+	configure(settings RoomSettings)
+
+	// resets and starts a game, players are the room's non spectators in
+	// join order
+	start(players []*Player) error
+
+	// player action routed from the room
+	handleAction(tgam *TriviaGameActionMessage)
+
+	// timerC fired
+	handleTimer()
+
+	// the mode's timer, the room waits on it next to player actions
+	timerC() <-chan time.Time
+
+	// second timer for things that happen inside a round, like hints
+	hintTimerC() <-chan time.Time
+
+	// hintTimerC fired
+	handleHintTimer()
+
+	// current game state, full includes teams and player lists
+	snapshot(full bool) TriviaStateUpdateMessage
+
+	// sends the snapshot to the room
+	broadcast(full bool)
+
+	roundState() RoundState
+
+	// player left the room or stopped playing
+	removePlayer(p *Player)
+
+	// game is being thrown away
+	stop()
+}
+
+// modes with teams the owner can arrange from the lobby
+type teamArranger interface {
+	// false for modes built on the trivia game that play without teams
+	hasTeams() bool
+
+	balanceTeams(players []*Player)
+	shuffleTeams(players []*Player)
+}
+
+// modes with team captains the owner can assign
+type captainAssigner interface {
+	assignCaptain(p *Player) error
+}
+
+// what a mode gets from its room
+type gameHooks struct {
+	// sends a state update to every player in the room
+	broadcast func(TriviaStateUpdateMessage)
+
+	// sends a state update to a single player
+	send func(*Player, TriviaStateUpdateMessage)
+
+	// sends an error back to a single player
+	sendError func(*Player, string)
+
+	// moves a player between playing and spectating mid game
+	spectate func(*Player, bool)
+
+	log   *slog.Logger
+	debug bool
+}
+
+// constructors for every mode a room can pick, modes add themselves from init
+var gameModes = map[string]func(gameHooks) GameMode{}
+
+func registerGameMode(name string, ctor func(gameHooks) GameMode) {
+	gameModes[name] = ctor
+}
+
+// names of the registered modes, sorted
+func gameModeNames() []string {
+	names := []string{}
+	for name := range gameModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// builds the mode and applies the room settings, nil if there is no such mode
+func newGameMode(name string, hooks gameHooks, settings RoomSettings) GameMode {
+	ctor, ok := gameModes[name]
+	if !ok {
+		return nil
+	}
+	g := ctor(hooks)
+	g.configure(settings)
+	return g
+}
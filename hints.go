@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+)
+
+// hints for free text questions come out on a schedule inside the round
+
+// hints a question has, see Question.hints
+const HintCount = 3
+
+// points lost for every hint out when the answer came in
+const HintPenalty = 20
+
+func newStoppedTimer() *time.Timer {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return timer
+}
+
+// free text questions get their hints spread evenly over the round
+func (t *TriviaGame) hintInterval() time.Duration {
+	return t.roundTime / (HintCount + 1)
+}
+
+// starts the hint schedule for a new round
+func (t *TriviaGame) scheduleHints() {
+	t.hints = 0
+	stopTimer(t.hintTimer)
+	if t.question != nil && len(t.question.Options) == 0 {
+		t.hintTimer.Reset(t.hintInterval())
+	}
+}
+
+func (t *TriviaGame) handleHintTimer() {
+	if t.state != InRound || t.hints >= HintCount {
+		return
+	}
+	t.hints++
+	if t.hints < HintCount {
+		t.hintTimer.Reset(t.hintInterval())
+	}
+	t.log.Debug("hint revealed", "round", t.round, "hints", t.hints)
+	t.broadcast(false)
+}
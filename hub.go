@@ -2,8 +2,8 @@ package main
 
 import (
 	"encoding/json"
-
-	"github.com/google/uuid"
+	"sync/atomic"
+	"time"
 )
 
 // Hub maintains the set of active clients and broadcasts messages to the
@@ -23,120 +23,239 @@ type Hub struct {
 
 	// List of rooms
 	rooms map[string]*Room
+
+	// work from other goroutines (http handlers) that needs the hub state
+	requests chan func(*Hub)
+
+	// set once run() has started
+	ready atomic.Bool
+
+	// room creation rate limits by ip
+	roomCreations map[string]*tokenBucket
 }
 
 func newHub() *Hub {
 	return &Hub{
-		incoming:   make(chan IncomingMessage),
-		register:   make(chan *Player),
-		unregister: make(chan *Player),
-		players:    make(map[*Player]bool),
-		rooms:      make(map[string]*Room),
+		incoming:      make(chan IncomingMessage),
+		register:      make(chan *Player),
+		unregister:    make(chan *Player),
+		players:       make(map[*Player]bool),
+		rooms:         make(map[string]*Room),
+		requests:      make(chan func(*Hub)),
+		roomCreations: make(map[string]*tokenBucket),
 	}
 }
 
+// runs f on the hub goroutine and waits for it to finish
+func (h *Hub) do(f func(*Hub)) {
+	done := make(chan struct{})
+	h.requests <- func(h *Hub) {
+		f(h)
+		close(done)
+	}
+	<-done
+}
+
 // async safe join room
-func (h *Hub) joinRoom(p *Player, code string) {
-	if p.room != nil {
-		p.send <- serverErrorHelper("this player is already in a room")
+func (h *Hub) joinRoom(p *Player, m JoinRoomMessage) {
+	if p.room != nil || p.waiting != nil {
+		p.queue(serverErrorHelper("this player is already in a room"))
 		return
 	}
-	if room, in := h.rooms[code]; !in {
-		p.send <- serverErrorHelper("this room does not exist")
+	if room, in := h.rooms[normalizeRoomCode(m.Code)]; !in {
+		p.queue(serverErrorHelper("this room does not exist"))
+		return
+	} else if room.isBanned(p) {
+		p.queue(serverErrorHelper("you are banned from this room"))
+		return
+	} else if !room.checkPassword(m.Password) {
+		p.logger().Info("wrong room password", "room", room.code)
+		p.queue(serverErrorHelper("wrong room password"))
 		return
 	} else {
 		ram := RoomActionMessage{}
 		ram.from = p
-		ram.Join = boolPtr(true)
-		room.incomingRoomActions <- ram // will join on next update
+		ram.Join = ptr(true)
+		ram.Spectate = ptr(m.Spectate)
+		// will join on next update
+		if !room.sendRoomAction(ram) {
+			p.queue(serverErrorHelper("this room does not exist"))
+			return
+		}
+		p.entered = room
 	}
 }
 
-func (h *Hub) createRoom(creator *Player) {
-	if creator.room != nil {
-		creator.send <- serverErrorHelper("this player is already in a room")
+func (h *Hub) createRoom(creator *Player, settings RoomSettings) {
+	if creator.room != nil || creator.waiting != nil {
+		creator.queue(serverErrorHelper("this player is already in a room"))
+		return
+	}
+	if ok, retry := h.allowRoomCreation(creator.ip, time.Now()); !ok {
+		creator.logger().Warn("room creation rate limited")
+		creator.queue(rateLimitErrorHelper(CreateRoom, retry))
 		return
 	}
-	id := uuid.New().String()
+	id := h.newRoomCode()
 	newroom := newRoom(id, false)
+	newroom.settings = settings
 	newroom.join(creator)
 	h.rooms[id] = newroom
 	creator.room = newroom
+	creator.entered = newroom
+	metrics.setActiveRooms(len(h.rooms))
 
+	newroom.log.Info("room created", "player", creator.id, "public", settings.Public)
+	newroom.publishListing()
 	newroom.broadcastRoomUpdate(true)
 
-	go func() { // TODO add stopper
-		for {
+	go func() {
+		for !newroom.closed {
 			newroom.run()
 		}
 	}()
 }
 
+// per ip room creation limit
+func (h *Hub) allowRoomCreation(ip string, now time.Time) (bool, time.Duration) {
+	for k, b := range h.roomCreations {
+		if b.full(now) {
+			delete(h.roomCreations, k)
+		}
+	}
+	b, in := h.roomCreations[ip]
+	if !in {
+		b = newTokenBucket(roomCreationLimit, now)
+		h.roomCreations[ip] = b
+	}
+	return b.allow(now)
+}
+
+// removes the room from the hub and shuts it down, players stay connected
+func (h *Hub) closeRoom(room *Room, reason string) {
+	if h.rooms[room.code] != room {
+		return
+	}
+	delete(h.rooms, room.code)
+	metrics.setActiveRooms(len(h.rooms))
+	go room.do(func(r *Room) { r.shutdown(reason) })
+}
+
+// finds a connected player by id
+func (h *Hub) findPlayer(id string) *Player {
+	for p := range h.players {
+		if p.id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// sends a notice to every connected player
+func (h *Hub) announce(msg string) {
+	for p := range h.players {
+		p.queue(noticeHelper(msg))
+	}
+}
+
 func (h *Hub) run() {
+	h.ready.Store(true)
 	for {
 		select {
+		case f := <-h.requests:
+			f(h)
 		case player := <-h.register:
 			h.players[player] = true
+			metrics.setConnectedPlayers(len(h.players))
+			player.logger().Info("player connected")
 		case player := <-h.unregister:
-			if player.room != nil {
-				if _, in := h.rooms[player.room.code]; in {
-					// its ok to do this as player.send is buffered by 256 msges
-					player.room.removePlayer(player)
-				}
+			// gone players can't be admitted, so a join still on its way to
+			// the room can't bring them back
+			player.close()
+			// the room goroutine can admit the player at any time, only it
+			// knows whether they are in the room or still queued
+			if room := player.entered; room != nil {
+				room.do(func(r *Room) {
+					if _, in := r.players[player]; in {
+						r.removePlayer(player)
+						r.broadcastRoomUpdate(false)
+						r.game.broadcast(true)
+					} else {
+						r.removeWaiting(player.id)
+					}
+				})
 			}
 			delete(h.players, player)
-			close(player.send)
-			//fmt.Println("Unregistered client and removed from room")
+			metrics.setConnectedPlayers(len(h.players))
+			player.logger().Info("player disconnected")
 			break
 		case message := <-h.incoming:
+			metrics.messageIn(message.Type)
+			log := message.from.logger().With("type", message.Type.String())
+			log.Debug("message received")
 			switch message.Type {
 			case Connect:
-				//fmt.Println("New player connected from ", message.from.conn.RemoteAddr())
 				break
 			case JoinRoom:
 				m := JoinRoomMessage{}
 				if err := json.Unmarshal(message.Content, &m); err != nil {
-					message.from.send <- serverErrorHelper("Bad format")
+					log.Warn("bad message content", "err", err)
+					message.from.queue(serverErrorHelper("Bad format"))
 				} else {
-					h.joinRoom(message.from, m.Code)
+					h.joinRoom(message.from, m)
 				}
 				break
 			case CreateRoom:
-				h.createRoom(message.from)
+				h.createRoom(message.from, defaultRoomSettings())
+				break
+			case ListRooms:
+				message.from.queue(roomListHelper(h.publicRooms()))
+				break
+			case QuickPlay:
+				h.quickPlay(message.from)
 				break
 			case RoomAction:
 				// RoomAction is join/leave room, switch team, send chat message
 
 				// parse the message content as a room message and send to room handler
-				if message.from.room != nil {
+				// the room loop can clear room at any time, read it once. queued
+				// players go to the room they wait for so they can leave
+				room := message.from.room
+				if room == nil {
+					room = message.from.waiting
+				}
+				if room != nil {
 					rm := RoomActionMessage{}
 					rm.from = message.from
 					if err := json.Unmarshal(message.Content, &rm); err != nil {
-						message.from.send <- serverErrorHelper("Bad RoomActionMessage format")
-					} else {
-						message.from.room.incomingRoomActions <- rm
+						log.Warn("bad message content", "err", err)
+						message.from.queue(serverErrorHelper("Bad RoomActionMessage format"))
+					} else if !room.sendRoomAction(rm) {
+						message.from.queue(serverErrorHelper("Not in a room"))
 					}
 				} else {
-					message.from.send <- serverErrorHelper("Not in a room")
+					message.from.queue(serverErrorHelper("Not in a room"))
 				}
 				break
 			case GameAction:
 				// related to the trivia gamestate itself
 
-				if message.from.room != nil {
+				if room := message.from.room; room != nil {
 					gam := TriviaGameActionMessage{}
 					gam.from = message.from
 					if err := json.Unmarshal(message.Content, &gam); err != nil {
-						message.from.send <- serverErrorHelper("Bad TriviaGameActionMessage format")
+						log.Warn("bad message content", "err", err)
+						message.from.queue(serverErrorHelper("Bad TriviaGameActionMessage format"))
 
-					} else {
-						message.from.room.incomingTriviaActions <- gam
+					} else if !room.sendGameAction(gam) {
+						message.from.queue(serverErrorHelper("Not in a room"))
 					}
 				} else {
-					message.from.send <- serverErrorHelper("Not in a room")
+					message.from.queue(serverErrorHelper("Not in a room"))
 				}
 				break
 			default:
+				log.Warn("unknown message type")
 				break
 			}
 		}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// lifelines players can spend during a round
+const (
+	LifelineFiftyFifty = "fiftyFifty" // hides two wrong options
+	LifelineSkip       = "skip"       // swaps in another question
+	LifelineExtraTime  = "extraTime"  // longer answer window
+)
+
+// time added by an extra time lifeline
+const ExtraTimeLifeline = 5 * time.Second
+
+var (
+	errNoOptions       = errors.New("This question doesn't have enough options")
+	errAlreadyHalved   = errors.New("You already used 50/50 this round")
+	errNothingToSkipTo = errors.New("There are no questions left to skip to")
+)
+
+// lifelines per game, also what's left of them
+type LifelineCounts struct {
+	FiftyFifty int `json:"fiftyFifty"`
+	Skip       int `json:"skip"`
+	ExtraTime  int `json:"extraTime"`
+}
+
+var defaultLifelineCounts = LifelineCounts{FiftyFifty: 1, Skip: 1, ExtraTime: 1}
+
+func (c LifelineCounts) valid() bool {
+	return c.FiftyFifty >= 0 && c.Skip >= 0 && c.ExtraTime >= 0
+}
+
+// the counter for a lifeline, nil if there is no such lifeline
+func (c *LifelineCounts) count(name string) *int {
+	switch name {
+	case LifelineFiftyFifty:
+		return &c.FiftyFifty
+	case LifelineSkip:
+		return &c.Skip
+	case LifelineExtraTime:
+		return &c.ExtraTime
+	}
+	return nil
+}
+
+// what lifelines changed about the round for one player
+type questionOverride struct {
+	// skipped to this question, nil for the round's question
+	question *Question
+
+	// options left after 50/50, nil for all of them
+	options []string
+
+	// added to the round time
+	extra time.Duration
+}
+
+// lifelines belong to the team, or the player in free for all. nil for a
+// player without a team
+func (t *TriviaGame) lifelineHolder(p *Player) any {
+	if t.freeForAll {
+		return p
+	}
+	if team := t.teamOf(p); team != nil {
+		return team
+	}
+	return nil
+}
+
+// players sharing p's lifelines
+func (t *TriviaGame) lifelineMembers(p *Player) []*Player {
+	if t.freeForAll {
+		return []*Player{p}
+	}
+	members := []*Player{}
+	for member := range t.teamOf(p).members {
+		members = append(members, member)
+	}
+	return members
+}
+
+func (t *TriviaGame) override(p *Player) *questionOverride {
+	o, ok := t.overrides[p]
+	if !ok {
+		o = &questionOverride{}
+		t.overrides[p] = o
+	}
+	return o
+}
+
+// the question p is answering this round
+func (t *TriviaGame) questionFor(p *Player) *Question {
+	if o, ok := t.overrides[p]; ok && o.question != nil {
+		return o.question
+	}
+	return t.question
+}
+
+// did p answer their question correctly this round
+func (t *TriviaGame) correctGuess(p *Player) bool {
+	guess, ok := t.roundVotes[p]
+	return ok && t.questionFor(p).correct(guess)
+}
+
+func (t *TriviaGame) deadlineFor(p *Player) time.Time {
+	deadline := t.roundStart.Add(t.roundTime)
+	if o, ok := t.overrides[p]; ok {
+		deadline = deadline.Add(o.extra)
+	}
+	return deadline
+}
+
+// when the round ends, the latest deadline anyone has
+func (t *TriviaGame) roundDeadline() time.Time {
+	latest := t.roundStart.Add(t.roundTime)
+	for p := range t.overrides {
+		if deadline := t.deadlineFor(p); deadline.After(latest) {
+			latest = deadline
+		}
+	}
+	return latest
+}
+
+// has p's answer window closed while others got extra time
+func (t *TriviaGame) timeUp(p *Player) bool {
+	deadline := t.deadlineFor(p)
+	for _, o := range t.overrides {
+		if o.extra > 0 {
+			return time.Now().After(deadline)
+		}
+	}
+	return false
+}
+
+func (t *TriviaGame) useLifeline(p *Player, name string) {
+	if !t.freeForAll && !t.speaksForTeam(p) {
+		if t.teamOf(p) == nil {
+			t.roomErrorSender(p, "Pick a team first")
+		} else {
+			t.roomErrorSender(p, "Only your captain can use lifelines")
+		}
+		return
+	}
+	holder := t.lifelineHolder(p)
+	left, ok := t.lifelinesLeft[holder]
+	if !ok {
+		left = t.lifelineCounts
+	}
+	n := left.count(name)
+	if n == nil {
+		t.roomErrorSender(p, "Unknown lifeline")
+		return
+	}
+	if *n <= 0 {
+		t.roomErrorSender(p, "You have none of that lifeline left")
+		return
+	}
+	if t.timeUp(p) {
+		t.roomErrorSender(p, "Time is up")
+		return
+	}
+
+	members := t.lifelineMembers(p)
+	var err error
+	switch name {
+	case LifelineFiftyFifty:
+		err = t.fiftyFifty(p, members)
+	case LifelineSkip:
+		err = t.skip(members)
+	case LifelineExtraTime:
+		t.extraTime(members)
+	}
+	if err != nil {
+		t.roomErrorSender(p, err.Error())
+		return
+	}
+	*n--
+	t.lifelinesLeft[holder] = left
+	t.log.Info("lifeline used", "player", p.id, "lifeline", name, "round", t.round)
+	for _, member := range members {
+		t.sendSnapshotTo(member, false)
+	}
+}
+
+// hides two random wrong options, only for members
+func (t *TriviaGame) fiftyFifty(p *Player, members []*Player) error {
+	if o, ok := t.overrides[p]; ok && o.options != nil {
+		return errAlreadyHalved
+	}
+	q := t.questionFor(p)
+	wrong := []int{}
+	for i, option := range q.Options {
+		if !q.correct(option) {
+			wrong = append(wrong, i)
+		}
+	}
+	if len(wrong) < 3 {
+		return errNoOptions
+	}
+	rand.Shuffle(len(wrong), func(i, j int) { wrong[i], wrong[j] = wrong[j], wrong[i] })
+	hidden := map[int]bool{wrong[0]: true, wrong[1]: true}
+	options := []string{}
+	for i, option := range q.Options {
+		if !hidden[i] {
+			options = append(options, option)
+		}
+	}
+	for _, member := range members {
+		t.override(member).options = options
+	}
+	return nil
+}
+
+// gives members a fresh question, their votes on the old one are dropped
+func (t *TriviaGame) skip(members []*Player) error {
+	q := t.bank.random(t.asked)
+	if q == nil {
+		return errNothingToSkipTo
+	}
+	t.asked[q] = true
+	for _, member := range members {
+		o := t.override(member)
+		o.question = q
+		o.options = nil
+		if _, voted := t.roundVotes[member]; voted {
+			delete(t.roundVotes, member)
+			delete(t.guessTimes, member)
+			for i, g := range t.guessOrder {
+				if g == member {
+					t.guessOrder = append(t.guessOrder[:i], t.guessOrder[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pushes members' deadline back, the round lasts until the last deadline
+func (t *TriviaGame) extraTime(members []*Player) {
+	for _, member := range members {
+		t.override(member).extra += ExtraTimeLifeline
+	}
+	t.timer.Reset(time.Until(t.roundDeadline()))
+}
+
+// sends the round as p sees it
+func (t *TriviaGame) sendSnapshotTo(p *Player, updateTeams bool) {
+	if t.debugMode || t.roomGameUpdateSender == nil {
+		return
+	}
+	t.roomGameUpdateSender(p, t.snapshotFor(p, updateTeams))
+}
+
+// the round as p sees it, with their lifelines applied
+func (t *TriviaGame) snapshotFor(p *Player, updateTeams bool) TriviaStateUpdateMessage {
+	tsum := t.snapshot(updateTeams)
+	if o, ok := t.overrides[p]; ok && tsum.Question != nil {
+		q := t.questionFor(p)
+		qs := q.state()
+		if o.options != nil {
+			qs.Options = o.options
+		}
+		tsum.Question = &qs
+		if tsum.Answer != nil {
+			tsum.Answer = &q.Answer
+		}
+		if tsum.Hints != nil {
+			hints := q.hints(t.hints)
+			tsum.Hints = &hints
+		}
+		if o.extra > 0 && t.state == InRound {
+			roundTime := int((t.roundTime + o.extra).Seconds())
+			tsum.RoundTime = &roundTime
+		}
+	}
+	if holder := t.lifelineHolder(p); holder != nil {
+		left, ok := t.lifelinesLeft[holder]
+		if !ok {
+			left = t.lifelineCounts
+		}
+		tsum.Lifelines = &left
+	}
+	return tsum
+}
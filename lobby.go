@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// public summary of a room for the room browser
+type RoomListing struct {
+	Code     string       `json:"code"`
+	Players  int          `json:"players"`
+	State    RoundState   `json:"state"`
+	Settings RoomSettings `json:"settings"`
+}
+
+// copies the room info into listing, must run on the room goroutine
+func (r *Room) publishListing() {
+	l := RoomListing{
+		Code:     r.code,
+		Players:  r.playerCount(),
+		State:    r.game.roundState(),
+		Settings: r.settings,
+	}
+	r.listingMu.Lock()
+	defer r.listingMu.Unlock()
+	r.listing = l
+}
+
+// safe to call from any goroutine
+func (r *Room) currentListing() RoomListing {
+	r.listingMu.Lock()
+	defer r.listingMu.Unlock()
+	return r.listing
+}
+
+// public rooms still in the lobby with someone in them, fullest first, must
+// run on the hub goroutine
+func (h *Hub) publicRooms() []RoomListing {
+	list := []RoomListing{}
+	for _, room := range h.rooms {
+		l := room.currentListing()
+		if l.Settings.Public && l.State == InLobby && l.Players > 0 {
+			list = append(list, l)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Players != list[j].Players {
+			return list[i].Players > list[j].Players
+		}
+		return list[i].Code < list[j].Code
+	})
+	return list
+}
+
+// puts the player in the fullest open public lobby that still has space, or
+// makes a new public room when there is none
+func (h *Hub) quickPlay(p *Player) {
+	if p.room != nil || p.waiting != nil {
+		p.queue(serverErrorHelper("this player is already in a room"))
+		return
+	}
+	for _, l := range h.publicRooms() {
+		full := l.Settings.MaxPlayers > 0 && l.Players >= l.Settings.MaxPlayers
+		if !full && !l.Settings.HasPassword && !l.Settings.InviteOnly {
+			h.joinRoom(p, JoinRoomMessage{Code: l.Code})
+			return
+		}
+	}
+	settings := defaultRoomSettings()
+	settings.Public = true
+	h.createRoom(p, settings)
+}
+
+func roomListHelper(rooms []RoomListing) OutgoingMessage {
+	tobyte, _ := json.Marshal(RoomListMessage{rooms})
+	return OutgoingMessage{
+		Type:    RoomList,
+		Content: tobyte,
+	}
+}
+
+// serves /rooms, the public room browser
+func serveRoomList(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	var list []RoomListing
+	hub.do(func(h *Hub) { list = h.publicRooms() })
+	writeJSON(w, http.StatusOK, RoomListMessage{list})
+}
@@ -4,22 +4,30 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-func boolPtr(v bool) *bool {
+func ptr[T any](v T) *T {
 	x := v
 	return &x
 }
 
+func derefString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
 var addr = flag.String("addr", ":9100", "http service address")
 
 func serveHome(w http.ResponseWriter, r *http.Request) {
-	log.Println(r.URL)
+	slog.Debug("http request", "url", r.URL.String(), "remote", r.RemoteAddr)
 	if r.URL.Path != "/" {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
@@ -33,18 +41,43 @@ func serveHome(w http.ResponseWriter, r *http.Request) {
 
 // serveWs handles websocket requests from the peer.
 func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	identity, err := authenticate(r)
+	if err != nil {
+		slog.Warn("websocket auth failed", "remote", r.RemoteAddr, "err", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ip := remoteIP(r)
+	if !connLimiter.acquire(ip, *maxConnsPerIP) {
+		slog.Warn("too many connections", "remote", r.RemoteAddr)
+		http.Error(w, "Too many connections", http.StatusTooManyRequests)
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		connLimiter.release(ip)
+		slog.Warn("websocket upgrade failed", "remote", r.RemoteAddr, "err", err)
 		return
 	}
+	id := uuid.New().String()
 	player := &Player{
-		name: fmt.Sprintf("Player %v", uuid.New().String()),
-		hub:  hub,
-		conn: conn,
-		send: make(chan OutgoingMessage, 512), // buffer the send channel by 512 messages to prevent panic overflow
+		id:       id,
+		name:     fmt.Sprintf("Player %v", id),
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan OutgoingMessage, 512), // buffer the send channel by 512 messages to prevent panic overflow
+		done:     make(chan struct{}),
+		identity: identity,
+		ip:       ip,
 	}
+	logger := slog.Default().With("player", id, "remote", conn.RemoteAddr().String())
+	if identity != nil {
+		logger = logger.With("identity", identity.Subject)
+		if identity.Name != "" {
+			player.name = identity.Name
+		}
+	}
+	player.log = logger
 	player.hub.register <- player
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -54,11 +87,30 @@ func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	fmt.Println("Starting server")
 	flag.Parse()
+	logger, err := newLogger(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	if *requireAuth && *authSecret == "" {
+		slog.Error("-require-auth needs an -auth-secret to verify tokens")
+		os.Exit(2)
+	}
+	upgrader.CheckOrigin = checkOrigin
+	slog.Info("starting server", "addr", *addr)
 	hub := newHub()
 	go hub.run()
 	http.HandleFunc("/", serveHome)
+	http.HandleFunc("/metrics", serveMetrics)
+	registerAdminRoutes(http.DefaultServeMux, hub)
+	http.HandleFunc("GET /join/{code}", func(w http.ResponseWriter, r *http.Request) {
+		serveInvite(hub, w, r)
+	})
+	http.HandleFunc("GET /rooms", func(w http.ResponseWriter, r *http.Request) {
+		serveRoomList(hub, w, r)
+	})
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		serveWs(hub, w, r)
 	})
@@ -66,9 +118,8 @@ func main() {
 		Addr:              *addr,
 		ReadHeaderTimeout: 3 * time.Second,
 	}
-	err := server.ListenAndServe()
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("ListenAndServe", "err", err)
+		os.Exit(1)
 	}
-	fmt.Println("Serving on ", addr)
 }
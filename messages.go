@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"time"
 )
 
 type PlayerMessageType int
@@ -14,14 +15,54 @@ const (
 	CreateRoom PlayerMessageType = 2
 	RoomAction PlayerMessageType = 3
 	GameAction PlayerMessageType = 4
+	ListRooms  PlayerMessageType = 5
+	QuickPlay  PlayerMessageType = 6
 
 	// outgoing message types
 
 	ServerError      ServerMessageType = 0
 	RoomUpdate       ServerMessageType = 1
 	TriviaGameUpdate ServerMessageType = 2
+	Notice           ServerMessageType = 3
+	RoomList         ServerMessageType = 4
 )
 
+func (t PlayerMessageType) String() string {
+	switch t {
+	case Connect:
+		return "connect"
+	case JoinRoom:
+		return "join_room"
+	case CreateRoom:
+		return "create_room"
+	case RoomAction:
+		return "room_action"
+	case GameAction:
+		return "game_action"
+	case ListRooms:
+		return "list_rooms"
+	case QuickPlay:
+		return "quick_play"
+	}
+	return "unknown"
+}
+
+func (t ServerMessageType) String() string {
+	switch t {
+	case ServerError:
+		return "server_error"
+	case RoomUpdate:
+		return "room_update"
+	case TriviaGameUpdate:
+		return "trivia_game_update"
+	case Notice:
+		return "notice"
+	case RoomList:
+		return "room_list"
+	}
+	return "unknown"
+}
+
 // raw from clients
 type IncomingMessage struct {
 	from    *Player
@@ -38,6 +79,12 @@ type OutgoingMessage struct {
 // incoming
 type JoinRoomMessage struct {
 	Code string `json:"code"`
+
+	// room password, only checked if the room has one
+	Password string `json:"password"`
+
+	// join as a spectator
+	Spectate bool `json:"spectate"`
 }
 
 // outgoing
@@ -66,11 +113,99 @@ type RoomActionMessage struct {
 
 	// makes the sender leave the room
 	Leave *bool `json:"leave"`
+
+	// join as a spectator when sent with join, otherwise switch between
+	// playing and spectating in the lobby
+	Spectate *bool `json:"spectate"`
+
+	// owner only, list the room in the public room browser
+	Public *bool `json:"public"`
+
+	// owner only, set the room password, empty string removes it
+	Password *string `json:"password"`
+
+	// owner only, require approval for every join
+	InviteOnly *bool `json:"inviteOnly"`
+
+	// owner only, id of a pending player to let in
+	Approve *string `json:"approve"`
+
+	// owner only, id of a pending player to turn away
+	Deny *string `json:"deny"`
+
+	// owner only, room size limit, 0 for no limit
+	MaxPlayers *int `json:"maxPlayers"`
+
+	// owner only, team size limit, 0 for no limit
+	MaxTeamSize *int `json:"maxTeamSize"`
+
+	// owner only, spectator limit, 0 for no limit
+	MaxSpectators *int `json:"maxSpectators"`
+
+	// owner only, auto assign teams on start instead of refusing unfair teams
+	AutoAssignTeams *bool `json:"autoAssignTeams"`
+
+	// owner only, even out the teams in the lobby
+	Balance *bool `json:"balance"`
+
+	// owner only, randomly deal everyone onto teams in the lobby
+	Shuffle *bool `json:"shuffle"`
+
+	// owner only, number of teams in the lobby, MinTeams to MaxTeams
+	Teams *int `json:"teams"`
+
+	// owner only, name of a registered game mode, lobby only
+	Mode *string `json:"mode"`
+
+	// owner only, name of a scoring formula, lobby only
+	Scoring *string `json:"scoring"`
+
+	// owner only, how teams answer, see teamAnswerModes, lobby only
+	TeamAnswer *string `json:"teamAnswer"`
+
+	// owner only, lifelines per team or player each game, lobby only
+	Lifelines *LifelineCounts `json:"lifelines"`
+
+	// owner only, teams draft categories between rounds, lobby only
+	CategoryDraft *bool `json:"categoryDraft"`
+
+	// owner only, regular rounds before the final wager round, 0 for
+	// endless rounds, lobby only
+	Rounds *int `json:"rounds"`
+
+	// owner only, room name of a player to make their team's captain
+	Captain *string `json:"captain"`
+
+	// owner only, room name of a player to remove
+	Kick *string `json:"kick"`
+
+	// owner only, room name of a player to remove and keep out
+	Ban *string `json:"ban"`
+
+	// owner only, room name of a player to silence in chat
+	Mute *string `json:"mute"`
+
+	// owner only, room name of a player to let chat again
+	Unmute *string `json:"unmute"`
 }
 
 // outgoing
 type ErrorWithMessage struct {
-	message string
+	Message string `json:"message"`
+
+	// machine readable error kind, empty for generic errors
+	Code string `json:"code,omitempty"`
+
+	// for rate limit errors, when the client may retry
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"`
+
+	// for rate limit errors, which message type was limited
+	Limited string `json:"limited,omitempty"`
+}
+
+// outgoing, informational text such as server announcements
+type NoticeMessage struct {
+	Message string `json:"message"`
 }
 
 // outgoing
@@ -84,22 +219,36 @@ type RoomUpdateMessage struct {
 	// playerlist TODO make player id/name and make this optional
 	Players []string `json:"players"`
 
+	// spectators, not included in players
+	Spectators []string `json:"spectators"`
+
 	// chat logs TODO make this a delta, not entire logs
 	Chat []string `json:"chat"`
+
+	// current room settings
+	Settings RoomSettings `json:"settings"`
+
+	// players waiting for approval, only sent to the owner
+	Pending []PendingPlayer `json:"pending,omitempty"`
+
+	// players waiting for a spot, in the order they will be let in
+	Waitlist []string `json:"waitlist"`
+}
+
+// outgoing, public rooms that can be joined
+type RoomListMessage struct {
+	Rooms []RoomListing `json:"rooms"`
 }
 
 // outgoing
 type TriviaStateUpdateMessage struct {
-	// list of blue team players
-	BlueTeam *[]string `json:"blueTeam"`
+	// teams in join index order with their players and scores
+	Teams *[]TeamState `json:"teams"`
 
-	// list of red team players
-	RedTeam *[]string `json:"redTeam"`
-
-	// limbo (0), round(1), lobby(2)
+	// limbo (0), round(1), lobby(2), wager(3), reveal(4)
 	State int `json:"state"`
 
-	// round time, send at start
+	// round time, send at start and to players who bought extra time
 	RoundTime *int `json:"roundTime"`
 
 	// limbo time, sent at start
@@ -107,17 +256,78 @@ type TriviaStateUpdateMessage struct {
 
 	// rounds since game started
 	Round int `json:"round"`
+
+	// name of the game mode being played
+	Mode string `json:"mode"`
+
+	// active question during a round, the question just asked during limbo
+	Question *QuestionState `json:"question"`
+
+	// correct answer, only revealed in limbo
+	Answer *string `json:"answer"`
+
+	// individual scores in free for all, highest first
+	Leaderboard *[]LeaderboardEntry `json:"leaderboard"`
+
+	// buzz order and answer window, buzzer mode only
+	Buzzer *BuzzerState `json:"buzzer"`
+
+	// category draft turn, offer and picks so far
+	Draft *DraftState `json:"draft"`
+
+	// hints revealed so far this round, free text questions only
+	Hints *[]string `json:"hints"`
+
+	// who answered last round, how fast and for how many points
+	Answers *[]AnswerState `json:"answers"`
+
+	// live votes of the player's own team, only sent to that team
+	TeamVotes *[]VoteState `json:"teamVotes"`
+
+	// lifelines the player's team, or the player, has left. only sent to
+	// them
+	Lifelines *LifelineCounts `json:"lifelines"`
+
+	// who has bet on the final round, amounts only once revealed
+	Wagers *[]WagerState `json:"wagers"`
+
+	// categories and values left, board mode only
+	Board *BoardState `json:"board"`
+
+	// who is still in, elimination mode only
+	Alive *[]AliveState `json:"alive"`
+
+	// last player standing once an elimination game is over
+	Winner *string `json:"winner"`
 }
 
 // incoming
 type TriviaGameActionMessage struct {
 	ActionMessage
 
-	// which team to join, 0 is blue 1 is red, nil means no action
+	// index of the team to join, nil means no action
 	Join *int `json:"join"`
 
 	// which option in the trivia to guess
 	Guess *string `json:"guess"`
+
+	// lifeline to spend this round, see lifelines.go
+	Lifeline *string `json:"lifeline"`
+
+	// category for the next question when it's the team's turn to draft
+	Category *string `json:"category"`
+
+	// room name of a teammate to vote for as captain
+	Elect *string `json:"elect"`
+
+	// buzz in for the answer window, buzzer mode only
+	Buzz *bool `json:"buzz"`
+
+	// final round bet, up to the team's or player's score
+	Wager *int `json:"wager"`
+
+	// next question off the board, board mode only
+	Pick *BoardPick `json:"pick"`
 }
 
 // signals for internal messaging between goroutines
@@ -128,9 +338,32 @@ const TriviaGameTimerAlert InternalSignal = 0
 
 // generate a server error message
 func serverErrorHelper(msg string) OutgoingMessage {
-	tobyte, _ := json.Marshal(ErrorWithMessage{msg})
+	tobyte, _ := json.Marshal(ErrorWithMessage{Message: msg})
+	return OutgoingMessage{
+		Type:    ServerError,
+		Content: tobyte,
+	}
+}
+
+// generate a rate limit error for message type t
+func rateLimitErrorHelper(t PlayerMessageType, retry time.Duration) OutgoingMessage {
+	tobyte, _ := json.Marshal(ErrorWithMessage{
+		Message:      "Too many messages, slow down",
+		Code:         "rate_limited",
+		RetryAfterMs: retry.Milliseconds(),
+		Limited:      t.String(),
+	})
 	return OutgoingMessage{
 		Type:    ServerError,
 		Content: tobyte,
 	}
 }
+
+// generate a notice message
+func noticeHelper(msg string) OutgoingMessage {
+	tobyte, _ := json.Marshal(NoticeMessage{msg})
+	return OutgoingMessage{
+		Type:    Notice,
+		Content: tobyte,
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// histogram with fixed upper bounds, written out in prometheus format
+type histogram struct {
+	// upper bounds of each bucket, ascending
+	bounds []float64
+
+	// observations per bucket, not cumulative
+	counts []uint64
+
+	sum   float64
+	count uint64
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name string) {
+	var cumulative uint64
+	for i, b := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// Metrics collects server stats for the /metrics endpoint. The hub, rooms and
+// write pumps all run in their own goroutines so everything is behind one lock.
+type Metrics struct {
+	mu sync.Mutex
+
+	// registered players, set by the hub
+	connectedPlayers int
+
+	// rooms in Hub.rooms, set by the hub
+	activeRooms int
+
+	// number of games currently in each state
+	games map[RoundState]int
+
+	// messages received by the hub, by type
+	messagesIn map[PlayerMessageType]uint64
+
+	// messages queued on a player's send channel, by type
+	messagesOut map[ServerMessageType]uint64
+
+	// messages dropped because a player's send channel was full, by type
+	dropped map[ServerMessageType]uint64
+
+	// depth of the send channel after queueing a message
+	sendBufferDepth *histogram
+
+	// how long rounds actually ran, in seconds
+	roundDuration *histogram
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		games:           make(map[RoundState]int),
+		messagesIn:      make(map[PlayerMessageType]uint64),
+		messagesOut:     make(map[ServerMessageType]uint64),
+		dropped:         make(map[ServerMessageType]uint64),
+		sendBufferDepth: newHistogram(0, 1, 2, 4, 8, 16, 32, 64, 128, 256, 512),
+		roundDuration:   newHistogram(1, 2, 5, 10, 15, 20, 30, 60, 120),
+	}
+}
+
+// server wide metrics
+var metrics = newMetrics()
+
+func (m *Metrics) setConnectedPlayers(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connectedPlayers = n
+}
+
+func (m *Metrics) setActiveRooms(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.activeRooms = n
+}
+
+// a game was created in state s
+func (m *Metrics) gameCreated(s RoundState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.games[s]++
+}
+
+// a game was thrown away in state s
+func (m *Metrics) gameRemoved(s RoundState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.games[s]--
+}
+
+// a game moved between states
+func (m *Metrics) gameStateChanged(from RoundState, to RoundState) {
+	if from == to {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.games[from]--
+	m.games[to]++
+}
+
+func (m *Metrics) messageIn(t PlayerMessageType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messagesIn[t]++
+}
+
+// a message was queued, depth is the send buffer length after queueing
+func (m *Metrics) messageOut(t ServerMessageType, depth int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messagesOut[t]++
+	m.sendBufferDepth.observe(float64(depth))
+}
+
+func (m *Metrics) messageDropped(t ServerMessageType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped[t]++
+}
+
+func (m *Metrics) roundFinished(seconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roundDuration.observe(seconds)
+}
+
+// writes all metrics in the prometheus text exposition format
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP trivia_connected_players Number of players connected to the hub.")
+	fmt.Fprintln(w, "# TYPE trivia_connected_players gauge")
+	fmt.Fprintf(w, "trivia_connected_players %d\n", m.connectedPlayers)
+
+	fmt.Fprintln(w, "# HELP trivia_active_rooms Number of open rooms.")
+	fmt.Fprintln(w, "# TYPE trivia_active_rooms gauge")
+	fmt.Fprintf(w, "trivia_active_rooms %d\n", m.activeRooms)
+
+	fmt.Fprintln(w, "# HELP trivia_games Number of games by round state.")
+	fmt.Fprintln(w, "# TYPE trivia_games gauge")
+	states := []RoundState{}
+	for s := range m.games {
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	for _, s := range states {
+		fmt.Fprintf(w, "trivia_games{state=%q} %d\n", s.String(), m.games[s])
+	}
+
+	fmt.Fprintln(w, "# HELP trivia_messages_in_total Messages received from players by type.")
+	fmt.Fprintln(w, "# TYPE trivia_messages_in_total counter")
+	in := []PlayerMessageType{}
+	for t := range m.messagesIn {
+		in = append(in, t)
+	}
+	sort.Slice(in, func(i, j int) bool { return in[i] < in[j] })
+	for _, t := range in {
+		fmt.Fprintf(w, "trivia_messages_in_total{type=%q} %d\n", t.String(), m.messagesIn[t])
+	}
+
+	writeOutgoing(w, "trivia_messages_out_total", "Messages queued for players by type.", m.messagesOut)
+	writeOutgoing(w, "trivia_messages_dropped_total", "Messages dropped because the player's send buffer was full.", m.dropped)
+
+	fmt.Fprintln(w, "# HELP trivia_send_buffer_depth Player send buffer depth after queueing a message.")
+	fmt.Fprintln(w, "# TYPE trivia_send_buffer_depth histogram")
+	m.sendBufferDepth.write(w, "trivia_send_buffer_depth")
+
+	fmt.Fprintln(w, "# HELP trivia_round_duration_seconds How long trivia rounds ran.")
+	fmt.Fprintln(w, "# TYPE trivia_round_duration_seconds histogram")
+	m.roundDuration.write(w, "trivia_round_duration_seconds")
+}
+
+func writeOutgoing(w io.Writer, name string, help string, counts map[ServerMessageType]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	types := []ServerMessageType{}
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, t := range types {
+		fmt.Fprintf(w, "%s{type=%q} %d\n", name, t.String(), counts[t])
+	}
+}
+
+// serves the prometheus scrape endpoint
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.write(w)
+}
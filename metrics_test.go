@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := newMetrics()
+	m.setConnectedPlayers(3)
+	m.gameCreated(InLobby)
+	m.gameStateChanged(InLobby, InRound)
+	m.messageIn(RoomAction)
+	m.messageOut(RoomUpdate, 2)
+	m.messageDropped(RoomUpdate)
+	m.roundFinished(7)
+
+	b := strings.Builder{}
+	m.write(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		"trivia_connected_players 3\n",
+		"trivia_games{state=\"lobby\"} 0\n",
+		"trivia_games{state=\"round\"} 1\n",
+		"trivia_messages_in_total{type=\"room_action\"} 1\n",
+		"trivia_messages_out_total{type=\"room_update\"} 1\n",
+		"trivia_messages_dropped_total{type=\"room_update\"} 1\n",
+		"trivia_send_buffer_depth_bucket{le=\"2\"} 1\n",
+		"trivia_round_duration_seconds_bucket{le=\"5\"} 0\n",
+		"trivia_round_duration_seconds_bucket{le=\"10\"} 1\n",
+		"trivia_round_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %q in metrics output:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+)
+
+// prefix for chat entries written by the server
+const systemChatPrefix = "[system] "
+
+func (r *Room) writeSystemChat(msg string) {
+	r.writeChat(systemChatPrefix + msg)
+}
+
+// ban keys for a player, the session always and the external identity if
+// the player has one
+func banKeys(p *Player) []string {
+	keys := []string{"session:" + p.id}
+	if p.identity != nil {
+		keys = append(keys, "identity:"+p.identity.Subject)
+	}
+	return keys
+}
+
+// safe to call from any goroutine
+func (r *Room) isBanned(p *Player) bool {
+	r.listingMu.Lock()
+	defer r.listingMu.Unlock()
+	for _, k := range banKeys(p) {
+		if r.bans[k] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Room) ban(p *Player) {
+	r.listingMu.Lock()
+	defer r.listingMu.Unlock()
+	for _, k := range banKeys(p) {
+		r.bans[k] = true
+	}
+}
+
+func (r *Room) isMuted(p *Player) bool {
+	for _, k := range banKeys(p) {
+		if r.muted[k] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Room) setMuted(p *Player, muted bool) {
+	for _, k := range banKeys(p) {
+		if muted {
+			r.muted[k] = true
+		} else {
+			delete(r.muted, k)
+		}
+	}
+}
+
+// finds a player in the room by the name shown in the player list
+func (r *Room) findByRoomName(name string) *Player {
+	for p := range r.players {
+		if p.roomname == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// applies owner only kick, ban and mute actions, returns true if a player was
+// removed from the room
+func (r *Room) moderate(ram RoomActionMessage) bool {
+	if ram.Kick == nil && ram.Ban == nil && ram.Mute == nil && ram.Unmute == nil {
+		return false
+	}
+	if !r.isOwner(ram.from) {
+		r.sendErrorTo(ram.from, "Only the owner can moderate the room")
+		return false
+	}
+
+	// looks up the target, the owner can't target themselves
+	target := func(name string) *Player {
+		p := r.findByRoomName(name)
+		if p == nil {
+			r.sendErrorTo(ram.from, fmt.Sprintf("%s is not in this room", name))
+			return nil
+		}
+		if p == ram.from {
+			r.sendErrorTo(ram.from, "You can't moderate yourself")
+			return nil
+		}
+		return p
+	}
+
+	removed := false
+	if ram.Kick != nil {
+		if p := target(*ram.Kick); p != nil {
+			r.removePlayer(p)
+			p.queue(noticeHelper("You were kicked from the room"))
+			r.writeSystemChat(fmt.Sprintf("%s was kicked", p.roomname))
+			r.log.Info("player kicked", "player", p.id)
+			removed = true
+		}
+	}
+	if ram.Ban != nil {
+		if p := target(*ram.Ban); p != nil {
+			r.ban(p)
+			r.removePlayer(p)
+			p.queue(noticeHelper("You were banned from the room"))
+			r.writeSystemChat(fmt.Sprintf("%s was banned", p.roomname))
+			r.log.Info("player banned", "player", p.id)
+			removed = true
+		}
+	}
+	if ram.Mute != nil {
+		if p := target(*ram.Mute); p != nil {
+			r.setMuted(p, true)
+			r.writeSystemChat(fmt.Sprintf("%s was muted", p.roomname))
+			r.log.Info("player muted", "player", p.id)
+		}
+	}
+	if ram.Unmute != nil {
+		if p := target(*ram.Unmute); p != nil {
+			r.setMuted(p, false)
+			r.writeSystemChat(fmt.Sprintf("%s was unmuted", p.roomname))
+			r.log.Info("player unmuted", "player", p.id)
+		}
+	}
+	return removed
+}
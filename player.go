@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/json"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -33,7 +35,10 @@ var upgrader = websocket.Upgrader{
 
 // Player is a middleman between the websocket connection and the
 type Player struct {
-	// id
+	// unique id for this connection
+	id string
+
+	// display name
 	name string
 
 	// room name
@@ -50,6 +55,104 @@ type Player struct {
 
 	// room the player belongs to
 	room *Room
+
+	// room the player is queued to get into, see Room.requestJoin
+	waiting *Room
+
+	// last room the hub sent the player to, only touched by the hub
+	entered *Room
+
+	// set by close, rooms don't let gone players in
+	gone atomic.Bool
+
+	// closed by close, writePump writes what is queued and hangs up
+	done chan struct{}
+
+	// watching the room instead of playing
+	spectator bool
+
+	// asked to join waiting as a spectator, applied by Room.admit
+	spectateOnJoin bool
+
+	// external identity from the upgrade token, nil for anonymous players
+	identity *Identity
+
+	// ip the connection came from
+	ip string
+
+	// rate limits by message type, only touched by readPump
+	limits map[PlayerMessageType]*tokenBucket
+
+	// rate limit violations, only touched by readPump
+	abuse *tokenBucket
+
+	// logger with the connection context attached, see logger()
+	log *slog.Logger
+}
+
+// logger with the player's connection and room context attached, the room
+// goroutine writes p.room so the pumps use connLogger instead
+func (p *Player) logger() *slog.Logger {
+	l := p.connLogger()
+	if p.room != nil {
+		l = l.With("room", p.room.code)
+	}
+	return l
+}
+
+// logger with only the connection context, safe from the pumps
+func (p *Player) connLogger() *slog.Logger {
+	if p.log == nil {
+		return slog.Default()
+	}
+	return p.log
+}
+
+// queues a message for the write pump, dropping it if the send buffer is full
+// so a slow client can't block the hub or its room
+func (p *Player) queue(m OutgoingMessage) {
+	select {
+	case p.send <- m:
+		metrics.messageOut(m.Type, len(p.send))
+	default:
+		metrics.messageDropped(m.Type)
+	}
+}
+
+// marks the player gone and has writePump hang up once everything queued is
+// written, safe to call more than once
+func (p *Player) close() {
+	if !p.gone.Swap(true) && p.done != nil {
+		close(p.done)
+	}
+}
+
+// checks the message against the per connection rate limits, returns how long
+// to wait when it is over the limit
+func (p *Player) allowMessage(t PlayerMessageType, now time.Time) (bool, time.Duration) {
+	limit, limited := messageRateLimits[t]
+	if !limited {
+		return true, 0
+	}
+	if p.limits == nil {
+		p.limits = make(map[PlayerMessageType]*tokenBucket)
+	}
+	b, in := p.limits[t]
+	if !in {
+		b = newTokenBucket(limit, now)
+		p.limits[t] = b
+	}
+	return b.allow(now)
+}
+
+// records a rate limit violation, true when the player has used up its
+// allowance and should be disconnected
+func (p *Player) recordAbuse(now time.Time) bool {
+	if p.abuse == nil {
+		p.abuse = newTokenBucket(abuseLimit, now)
+	}
+	ok, _ := p.abuse.allow(now)
+	return !ok
 }
 
 // readPump pumps messages from the websocket connection to the
@@ -61,6 +164,7 @@ func (p *Player) readPump() {
 	defer func() {
 		p.hub.unregister <- p
 		p.conn.Close()
+		connLimiter.release(p.ip)
 	}()
 	p.conn.SetReadLimit(maxMessageSize)
 	p.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -69,7 +173,7 @@ func (p *Player) readPump() {
 		_, message, err := p.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				//log.Printf("Close error: %v", err)
+				p.connLogger().Warn("unexpected close", "err", err)
 			}
 			break
 		}
@@ -77,10 +181,22 @@ func (p *Player) readPump() {
 			from: p,
 		}
 		if err := json.Unmarshal(message, &parsed); err != nil {
-			//fmt.Println(p.conn.RemoteAddr(), "bad message format", string(message))
+			p.connLogger().Warn("bad message format", "err", err, "size", len(message))
+			p.queue(serverErrorHelper("Bad message format"))
+			continue
+		}
 
+		now := time.Now()
+		if ok, retry := p.allowMessage(parsed.Type, now); !ok {
+			p.connLogger().Warn("rate limited", "type", parsed.Type.String())
+			if p.recordAbuse(now) {
+				p.connLogger().Warn("disconnecting for exceeding rate limits")
+				p.queue(serverErrorHelper("Disconnected for sending too many messages"))
+				break
+			}
+			p.queue(rateLimitErrorHelper(parsed.Type, retry))
+			continue
 		}
-		//fmt.Println(string(message), content)
 
 		p.hub.incoming <- parsed
 	}
@@ -99,40 +215,19 @@ func (p *Player) writePump() {
 	}()
 	for {
 		select {
-		case message, ok := <-p.send:
+		case message := <-p.send:
 			p.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// The hub closed the channel.
-				p.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := p.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			if err := p.writeQueued([]OutgoingMessage{message}); err != nil {
 				return
 			}
-
-			arr := []OutgoingMessage{message}
-			n := len(p.send)
-			for i := 0; i < n; i++ {
-				arr = append(arr, <-p.send)
-			}
-			tobyte, err := json.Marshal(arr)
-			if err != nil {
-				//fmt.Println("Error marshalling", err)
-				em, _ := json.Marshal(OutgoingMessage{
-					Type:    ServerError,
-					Content: []byte("{}"),
-				})
-				w.Write(em)
-			} else {
-				//fmt.Println(string(tobyte))
-				w.Write(tobyte)
-			}
-
-			if err := w.Close(); err != nil {
-				return
+		case <-p.done:
+			// closing, send what is left then hang up
+			p.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if len(p.send) > 0 {
+				p.writeQueued(nil)
 			}
+			p.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
 		case <-ticker.C:
 			p.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := p.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -141,3 +236,29 @@ func (p *Player) writePump() {
 		}
 	}
 }
+
+// writes arr and everything waiting in the send buffer as one frame
+func (p *Player) writeQueued(arr []OutgoingMessage) error {
+	w, err := p.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+
+	n := len(p.send)
+	for i := 0; i < n; i++ {
+		arr = append(arr, <-p.send)
+	}
+	tobyte, err := json.Marshal(arr)
+	if err != nil {
+		p.connLogger().Error("marshalling outgoing messages", "err", err)
+		em, _ := json.Marshal(OutgoingMessage{
+			Type:    ServerError,
+			Content: []byte("{}"),
+		})
+		w.Write(em)
+	} else {
+		w.Write(tobyte)
+	}
+
+	return w.Close()
+}
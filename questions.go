@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Question struct {
+	Prompt string
+
+	// multiple choice options, empty for free text questions
+	Options []string
+
+	// correct option, or the expected free text answer
+	Answer string
+
+	Category string
+
+	// 1 (easy) to 3 (hard)
+	Difficulty int
+}
+
+// outgoing, what players see of the active question
+type QuestionState struct {
+	Prompt   string   `json:"prompt"`
+	Options  []string `json:"options"`
+	Category string   `json:"category"`
+}
+
+// source of questions for the game
+type QuestionBank interface {
+	// random question that isn't in exclude, nil when there are none left
+	random(exclude map[*Question]bool) *Question
+
+	// random question from a category at a difficulty that isn't in exclude,
+	// nil when there are none
+	pick(category string, difficulty int, exclude map[*Question]bool) *Question
+
+	// random question from a category that isn't in exclude, nil when there
+	// are none
+	randomIn(category string, exclude map[*Question]bool) *Question
+
+	// categories in the bank, in the order they first appear
+	categories() []string
+}
+
+type staticQuestionBank struct {
+	questions []*Question
+}
+
+func (b *staticQuestionBank) random(exclude map[*Question]bool) *Question {
+	return b.randomMatching(exclude, func(*Question) bool { return true })
+}
+
+func (b *staticQuestionBank) pick(category string, difficulty int, exclude map[*Question]bool) *Question {
+	return b.randomMatching(exclude, func(q *Question) bool {
+		return q.Category == category && q.Difficulty == difficulty
+	})
+}
+
+func (b *staticQuestionBank) randomIn(category string, exclude map[*Question]bool) *Question {
+	return b.randomMatching(exclude, func(q *Question) bool { return q.Category == category })
+}
+
+func (b *staticQuestionBank) categories() []string {
+	seen := make(map[string]bool)
+	list := []string{}
+	for _, q := range b.questions {
+		if !seen[q.Category] {
+			seen[q.Category] = true
+			list = append(list, q.Category)
+		}
+	}
+	return list
+}
+
+func (b *staticQuestionBank) randomMatching(exclude map[*Question]bool, match func(*Question) bool) *Question {
+	left := []*Question{}
+	for _, q := range b.questions {
+		if !exclude[q] && match(q) {
+			left = append(left, q)
+		}
+	}
+	if len(left) == 0 {
+		return nil
+	}
+	return left[rand.IntN(len(left))]
+}
+
+func (q *Question) state() QuestionState {
+	return QuestionState{
+		Prompt:   q.Prompt,
+		Options:  q.Options,
+		Category: q.Category,
+	}
+}
+
+// guesses match the answer ignoring case and surrounding spaces
+func (q *Question) correct(guess string) bool {
+	return strings.EqualFold(strings.TrimSpace(guess), q.Answer)
+}
+
+// hints for a free text question, up to n, easiest first
+func (q *Question) hints(n int) []string {
+	letters := 0
+	for _, r := range q.Answer {
+		if !unicode.IsSpace(r) {
+			letters++
+		}
+	}
+	first, _ := utf8.DecodeRuneInString(q.Answer)
+	all := []string{
+		fmt.Sprintf("Category: %s", q.Category),
+		fmt.Sprintf("The answer has %d letters", letters),
+		fmt.Sprintf("It starts with %q", unicode.ToUpper(first)),
+	}
+	return all[:min(n, len(all))]
+}
+
+// built in questions, used until rooms can bring their own
+var defaultQuestionBank QuestionBank = &staticQuestionBank{questions: []*Question{
+	{Prompt: "What gas do plants absorb from the air for photosynthesis?", Options: []string{"Oxygen", "Carbon dioxide", "Nitrogen", "Helium"}, Answer: "Carbon dioxide", Category: "Science", Difficulty: 1},
+	{Prompt: "How many legs does an insect have?", Options: []string{"4", "6", "8", "10"}, Answer: "6", Category: "Science", Difficulty: 1},
+	{Prompt: "What is the chemical symbol for gold?", Options: []string{"Ag", "Au", "Gd", "Go"}, Answer: "Au", Category: "Science", Difficulty: 2},
+	{Prompt: "Which planet is known as the Red Planet?", Options: []string{"Venus", "Mars", "Jupiter", "Mercury"}, Answer: "Mars", Category: "Science", Difficulty: 2},
+	{Prompt: "What is the most abundant gas in Earth's atmosphere?", Options: []string{"Oxygen", "Argon", "Nitrogen", "Carbon dioxide"}, Answer: "Nitrogen", Category: "Science", Difficulty: 3},
+	{Prompt: "Which element has atomic number 26?", Options: []string{"Iron", "Cobalt", "Nickel", "Copper"}, Answer: "Iron", Category: "Science", Difficulty: 3},
+
+	{Prompt: "What is the largest ocean on Earth?", Options: []string{"Atlantic", "Indian", "Pacific", "Arctic"}, Answer: "Pacific", Category: "Geography", Difficulty: 1},
+	{Prompt: "What is the capital of France?", Options: []string{"Lyon", "Paris", "Marseille", "Nice"}, Answer: "Paris", Category: "Geography", Difficulty: 1},
+	{Prompt: "Which river flows through Cairo?", Options: []string{"Nile", "Congo", "Niger", "Tigris"}, Answer: "Nile", Category: "Geography", Difficulty: 2},
+	{Prompt: "What is the capital of Canada?", Options: []string{"Toronto", "Vancouver", "Ottawa", "Montreal"}, Answer: "Ottawa", Category: "Geography", Difficulty: 2},
+	{Prompt: "What is the capital of Australia?", Options: []string{"Sydney", "Melbourne", "Canberra", "Perth"}, Answer: "Canberra", Category: "Geography", Difficulty: 3},
+	{Prompt: "Which country has the most natural lakes?", Options: []string{"Canada", "Russia", "United States", "Finland"}, Answer: "Canada", Category: "Geography", Difficulty: 3},
+
+	{Prompt: "Who was the first President of the United States?", Options: []string{"Abraham Lincoln", "George Washington", "Thomas Jefferson", "John Adams"}, Answer: "George Washington", Category: "History", Difficulty: 1},
+	{Prompt: "In which country are the pyramids of Giza?", Options: []string{"Mexico", "Peru", "Egypt", "Sudan"}, Answer: "Egypt", Category: "History", Difficulty: 1},
+	{Prompt: "In what year did World War II end?", Options: []string{"1943", "1944", "1945", "1946"}, Answer: "1945", Category: "History", Difficulty: 2},
+	{Prompt: "Which empire built the Colosseum?", Options: []string{"Greek", "Roman", "Ottoman", "Persian"}, Answer: "Roman", Category: "History", Difficulty: 2},
+	{Prompt: "In what year did the Berlin Wall fall?", Options: []string{"1987", "1989", "1991", "1993"}, Answer: "1989", Category: "History", Difficulty: 3},
+	{Prompt: "Who was the first emperor of a unified China?", Options: []string{"Qin Shi Huang", "Kublai Khan", "Sun Yat-sen", "Liu Bang"}, Answer: "Qin Shi Huang", Category: "History", Difficulty: 3},
+
+	{Prompt: "How many strings does a standard guitar have?", Options: []string{"4", "5", "6", "7"}, Answer: "6", Category: "Entertainment", Difficulty: 1},
+	{Prompt: "What color is Pac-Man?", Options: []string{"Red", "Yellow", "Blue", "Green"}, Answer: "Yellow", Category: "Entertainment", Difficulty: 1},
+	{Prompt: "Which band recorded 'Hey Jude'?", Options: []string{"The Rolling Stones", "The Beatles", "Queen", "The Who"}, Answer: "The Beatles", Category: "Entertainment", Difficulty: 2},
+	{Prompt: "In chess, which piece only moves diagonally?", Options: []string{"Rook", "Knight", "Bishop", "King"}, Answer: "Bishop", Category: "Entertainment", Difficulty: 2},
+	{Prompt: "Who composed the 'Moonlight Sonata'?", Options: []string{"Mozart", "Bach", "Beethoven", "Chopin"}, Answer: "Beethoven", Category: "Entertainment", Difficulty: 3},
+	{Prompt: "What is the hardest natural substance?", Answer: "Diamond", Category: "Science", Difficulty: 3},
+	{Prompt: "What is the longest river in South America?", Answer: "Amazon", Category: "Geography", Difficulty: 3},
+	{Prompt: "Which ship sank on its maiden voyage in 1912?", Answer: "Titanic", Category: "History", Difficulty: 3},
+	{Prompt: "Which instrument has 88 keys?", Answer: "Piano", Category: "Entertainment", Difficulty: 3},
+	{Prompt: "What was Disney's first feature-length animated film?", Options: []string{"Pinocchio", "Fantasia", "Snow White and the Seven Dwarfs", "Bambi"}, Answer: "Snow White and the Seven Dwarfs", Category: "Entertainment", Difficulty: 3},
+}}
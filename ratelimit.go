@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var maxConnsPerIP = flag.Int("max-conns-per-ip", 10, "concurrent websocket connections allowed per ip, 0 for no limit")
+
+// token bucket limits, rate is tokens refilled per second
+type rateLimit struct {
+	rate  float64
+	burst float64
+}
+
+// per connection limits by message type, types not listed here are not limited
+var messageRateLimits = map[PlayerMessageType]rateLimit{
+	Connect:    {rate: 1, burst: 2},
+	JoinRoom:   {rate: 1, burst: 3},
+	CreateRoom: {rate: 0.2, burst: 2},
+	RoomAction: {rate: 2, burst: 5},
+	GameAction: {rate: 5, burst: 10},
+	ListRooms:  {rate: 1, burst: 5},
+	QuickPlay:  {rate: 0.5, burst: 2},
+}
+
+// rate limit violations allowed before a connection is dropped, one is
+// forgiven every 10 seconds
+var abuseLimit = rateLimit{rate: 0.1, burst: 10}
+
+// room creations per ip
+var roomCreationLimit = rateLimit{rate: 1.0 / 60, burst: 3}
+
+type tokenBucket struct {
+	limit  rateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit rateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: limit.burst,
+		last:   now,
+	}
+}
+
+// takes a token if one is available, otherwise returns how long until one is
+func (b *tokenBucket) allow(now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(b.limit.burst, b.tokens+now.Sub(b.last).Seconds()*b.limit.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.limit.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// is the bucket back to full, used to forget idle buckets
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.rate >= b.limit.burst
+}
+
+// counts concurrent connections per ip
+type ipLimiter struct {
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+var connLimiter = &ipLimiter{conns: make(map[string]int)}
+
+// reserves a connection slot for ip, false when ip is at max
+func (l *ipLimiter) acquire(ip string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if max > 0 && l.conns[ip] >= max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *ipLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// ip of the peer without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
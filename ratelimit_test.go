@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(rateLimit{rate: 1, burst: 2}, now)
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.allow(now); !ok {
+			t.Fatalf("Burst should allow 2 messages, stopped at %d", i)
+		}
+	}
+	ok, retry := b.allow(now)
+	if ok || retry != time.Second {
+		t.Fatalf("Empty bucket should ask for a 1s wait, got %v %v", ok, retry)
+	}
+	if ok, _ := b.allow(now.Add(time.Second)); !ok {
+		t.Fatalf("Bucket should refill after 1s")
+	}
+}
+
+func TestAbusiveConnectionIsDropped(t *testing.T) {
+	now := time.Unix(0, 0)
+	p := &Player{}
+	dropped := false
+	for i := 0; i < 100 && !dropped; i++ {
+		if ok, _ := p.allowMessage(RoomAction, now); !ok {
+			dropped = p.recordAbuse(now)
+		}
+	}
+	if !dropped {
+		t.Fatalf("Player flooding room actions was never disconnected")
+	}
+}
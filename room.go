@@ -3,8 +3,71 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"sync"
 )
 
+// owner configurable room settings
+type RoomSettings struct {
+	// listed in the public room browser and used by quick play
+	Public bool `json:"public"`
+
+	// joining needs the room password
+	HasPassword bool `json:"hasPassword"`
+
+	// the owner approves every join
+	InviteOnly bool `json:"inviteOnly"`
+
+	// most players in the room, 0 for no limit
+	MaxPlayers int `json:"maxPlayers"`
+
+	// most players on one team, 0 for no limit
+	MaxTeamSize int `json:"maxTeamSize"`
+
+	// most spectators in the room, 0 for no limit
+	MaxSpectators int `json:"maxSpectators"`
+
+	// put unassigned players on teams and even them out when the game
+	// starts, otherwise starting fails until the teams are fair
+	AutoAssignTeams bool `json:"autoAssignTeams"`
+
+	// number of teams
+	Teams int `json:"teams"`
+
+	// name of a registered game mode, see gameModes
+	Mode string `json:"mode"`
+
+	// regular rounds before the final wager round, 0 for endless rounds
+	Rounds int `json:"rounds"`
+
+	// how correct answers are scored, see scoringFormulas
+	Scoring string `json:"scoring"`
+
+	// how a team's votes become its answer, see teamAnswerModes
+	TeamAnswer string `json:"teamAnswer"`
+
+	// lifelines each team, or player in free for all, gets per game
+	Lifelines LifelineCounts `json:"lifelines"`
+
+	// teams take turns picking the next category between rounds
+	CategoryDraft bool `json:"categoryDraft"`
+}
+
+// default room size
+const DefaultMaxPlayers = 8
+
+func defaultRoomSettings() RoomSettings {
+	return RoomSettings{
+		MaxPlayers:      DefaultMaxPlayers,
+		AutoAssignTeams: true,
+		Teams:           DefaultTeams,
+		Mode:            TeamsMode,
+		Scoring:         ScoringFlat,
+		TeamAnswer:      TeamAnswerEach,
+		Lifelines:       defaultLifelineCounts,
+	}
+}
+
 type Room struct {
 	// room code
 	code string
@@ -19,7 +82,7 @@ type Room struct {
 	chat []string
 
 	// room + game are closely related, no need for game's own goroutine. Room will control game
-	game *TriviaGame
+	game GameMode
 
 	// client actions for room (chat, join)
 	incomingRoomActions chan RoomActionMessage
@@ -29,6 +92,43 @@ type Room struct {
 
 	// is debugMode
 	debugMode bool
+
+	// logger with the room code attached
+	log *slog.Logger
+
+	// work from other goroutines (admin api) that needs the room state
+	requests chan func(*Room)
+
+	// set by shutdown, stops the room loop
+	closed bool
+
+	// closed by shutdown so waiting callers don't block forever
+	stopped chan struct{}
+
+	// owner configurable settings
+	settings RoomSettings
+
+	// players waiting for the owner to approve them, in request order
+	pending []*Player
+
+	// players waiting for a free spot in a full room, in request order
+	waitlist []*Player
+
+	// players who can't chat, by ban key so leaving doesn't clear it
+	muted map[string]bool
+
+	// guards listing, password and bans
+	listingMu sync.Mutex
+
+	// nil when the room has no password
+	password *roomPassword
+
+	// banned sessions and identities, see banKeys
+	bans map[string]bool
+
+	// copy of the room info the hub needs, published after every update so
+	// the hub never has to wait on the room goroutine
+	listing RoomListing
 }
 
 // room creator helper
@@ -40,9 +140,15 @@ func newRoom(id string, debug bool) *Room {
 		debugMode:             debug,
 		code:                  id,
 		chat:                  []string{},
+		settings:              defaultRoomSettings(),
+		muted:                 make(map[string]bool),
+		bans:                  make(map[string]bool),
+		log:                   slog.Default().With("room", id),
+		requests:              make(chan func(*Room)),
+		stopped:               make(chan struct{}),
 	}
-	g := newTriviaGame(r.broadcastGameUpdate, debug)
-	r.game = g
+	r.game = newGameMode(r.settings.Mode, r.gameHooks(), r.settings)
+	r.publishListing()
 	return &r
 }
 
@@ -53,34 +159,79 @@ func (r *Room) run() {
 		1. Incoming room/game action
 		2. Outgoing game update
 		3. Round timer
+		4. Hint timer
 	*/
 	select {
 	case ram := <-r.incomingRoomActions:
+		// queued players can only give up their spot
+		if _, in := r.players[ram.from]; !in && ram.from.waiting == r {
+			r.leaveQueue(ram)
+			break
+		}
+
 		// chat?
 		if ram.Chat != nil {
-			r.writeChat(fmt.Sprintf("%s: %s", ram.from.roomname, *ram.Chat))
+			if r.isMuted(ram.from) {
+				r.sendErrorTo(ram.from, "You are muted")
+			} else {
+				r.writeChat(fmt.Sprintf("%s: %s", ram.from.roomname, *ram.Chat))
+			}
 		}
 
 		// only the owner can start new games
 		if ram.Start != nil {
-			v, ok := r.players[ram.from]
-
-			if r.game.state == InRound {
+			if r.game.roundState() != InLobby {
 				r.sendErrorTo(ram.from, "Game already started")
-			} else if ok && v == 0 {
-				r.startGame()
+			} else if r.isOwner(ram.from) {
+				if err := r.startGame(); err != nil {
+					r.sendErrorTo(ram.from, err.Error())
+				} else {
+					r.game.broadcast(true)
+				}
 			} else {
 				r.sendErrorTo(ram.from, "Only the owner can start a match")
 			}
 		}
 
-		gameUpdate := false
-		// join the room
+		gameUpdate := r.updateSettings(ram)
+
+		// kick, ban and mute
+		if r.moderate(ram) {
+			gameUpdate = true
+		}
+
+		// balance or shuffle teams
+		if r.arrangeTeams(ram) {
+			gameUpdate = true
+		}
+
+		// owner picks a captain
+		if r.assignCaptain(ram) {
+			gameUpdate = true
+		}
+
+		// join the room, or switch between playing and spectating
 		if ram.Join != nil && *(ram.Join) {
-			r.join(ram.from)
+			if _, in := r.players[ram.from]; in {
+				r.sendErrorTo(ram.from, "You are already in this room")
+			} else {
+				ram.from.spectateOnJoin = ram.Spectate != nil && *ram.Spectate
+				if r.requestJoin(ram.from) {
+					gameUpdate = true
+				}
+			}
+		} else if ram.Spectate != nil && r.setSpectating(ram.from, *ram.Spectate) {
 			gameUpdate = true
 		}
 
+		// owner answers a join request
+		if ram.Approve != nil && r.decidePending(ram.from, *ram.Approve, true) {
+			gameUpdate = true
+		}
+		if ram.Deny != nil {
+			r.decidePending(ram.from, *ram.Deny, false)
+		}
+
 		// leave the room
 		if ram.Leave != nil && *(ram.Leave) {
 			r.removePlayer(ram.from)
@@ -91,17 +242,198 @@ func (r *Room) run() {
 		r.broadcastRoomUpdate(false)
 
 		if gameUpdate {
-			r.game.broadcastGameUpdate(true)
+			r.game.broadcast(true)
 		}
 	case tgam := <-r.incomingTriviaActions:
-		// route incoming game actions to the trivia handler
-		// TODO add error return channel
-		r.game.actionHandlerWithBroadcast(&tgam, nil)
-	case <-r.game.timer.C:
+		// route incoming game actions to the trivia handler, spectators only watch
+		if tgam.from.spectator {
+			r.sendErrorTo(tgam.from, "Spectators can't play")
+		} else {
+			r.game.handleAction(&tgam)
+		}
+	case f := <-r.requests:
+		f(r)
+	case <-r.game.timerC():
 		// timer went off, reroute back to game handler
-		signal := TriviaGameTimerAlert
-		r.game.actionHandlerWithBroadcast(nil, &signal)
+		r.game.handleTimer()
+	case <-r.game.hintTimerC():
+		r.game.handleHintTimer()
+	}
+	r.publishListing()
+}
+
+// applies owner only setting changes, returns true if players joined or the
+// teams changed because of it
+func (r *Room) updateSettings(ram RoomActionMessage) bool {
+	if ram.Public == nil && ram.Password == nil && ram.InviteOnly == nil &&
+		ram.MaxPlayers == nil && ram.MaxTeamSize == nil && ram.MaxSpectators == nil &&
+		ram.AutoAssignTeams == nil && ram.Teams == nil && ram.Mode == nil && ram.Rounds == nil &&
+		ram.Scoring == nil && ram.TeamAnswer == nil && ram.Lifelines == nil && ram.CategoryDraft == nil {
+		return false
+	}
+	if !r.isOwner(ram.from) {
+		r.sendErrorTo(ram.from, "Only the owner can change room settings")
+		return false
+	}
+	if (ram.MaxPlayers != nil && *ram.MaxPlayers < 0) || (ram.MaxTeamSize != nil && *ram.MaxTeamSize < 0) ||
+		(ram.MaxSpectators != nil && *ram.MaxSpectators < 0) || (ram.Rounds != nil && *ram.Rounds < 0) ||
+		(ram.Lifelines != nil && !ram.Lifelines.valid()) {
+		r.sendErrorTo(ram.from, "Limits can't be negative")
+		return false
+	}
+	if ram.Teams != nil && (*ram.Teams < MinTeams || *ram.Teams > MaxTeams) {
+		r.sendErrorTo(ram.from, fmt.Sprintf("Rooms can have %d to %d teams", MinTeams, MaxTeams))
+		return false
+	}
+	if _, ok := gameModes[derefString(ram.Mode)]; ram.Mode != nil && !ok {
+		r.sendErrorTo(ram.from, "Unknown game mode")
+		return false
+	}
+	if _, ok := scoringFormulas[derefString(ram.Scoring)]; ram.Scoring != nil && !ok {
+		r.sendErrorTo(ram.from, "Unknown scoring formula")
+		return false
+	}
+	if ram.TeamAnswer != nil && !teamAnswerModes[*ram.TeamAnswer] {
+		r.sendErrorTo(ram.from, "Unknown team answer mode")
+		return false
+	}
+	if (ram.Teams != nil || ram.Mode != nil || ram.MaxTeamSize != nil || ram.AutoAssignTeams != nil || ram.Rounds != nil ||
+		ram.Scoring != nil || ram.TeamAnswer != nil || ram.Lifelines != nil || ram.CategoryDraft != nil) &&
+		r.game.roundState() != InLobby {
+		r.sendErrorTo(ram.from, "Teams, mode, rounds and scoring can only be changed in the lobby")
+		return false
+	}
+
+	changed := false
+
+	if ram.Public != nil {
+		r.settings.Public = *ram.Public
+	}
+	if ram.Password != nil {
+		r.setPassword(*ram.Password)
+	}
+	if ram.InviteOnly != nil {
+		r.settings.InviteOnly = *ram.InviteOnly
+		if !r.settings.InviteOnly && len(r.pending) > 0 {
+			changed = r.admitAllPending() || changed
+		}
+	}
+	if ram.MaxTeamSize != nil {
+		r.settings.MaxTeamSize = *ram.MaxTeamSize
+		changed = true
+	}
+	if ram.MaxSpectators != nil {
+		r.settings.MaxSpectators = *ram.MaxSpectators
+	}
+	if ram.AutoAssignTeams != nil {
+		r.settings.AutoAssignTeams = *ram.AutoAssignTeams
+	}
+	if ram.Teams != nil {
+		r.settings.Teams = *ram.Teams
+		changed = true
+	}
+	if ram.Rounds != nil {
+		r.settings.Rounds = *ram.Rounds
+	}
+	if ram.Scoring != nil {
+		r.settings.Scoring = *ram.Scoring
+	}
+	if ram.TeamAnswer != nil {
+		r.settings.TeamAnswer = *ram.TeamAnswer
+	}
+	if ram.Lifelines != nil {
+		r.settings.Lifelines = *ram.Lifelines
+	}
+	if ram.CategoryDraft != nil {
+		r.settings.CategoryDraft = *ram.CategoryDraft
+	}
+	if ram.Mode != nil && *ram.Mode != r.settings.Mode {
+		r.settings.Mode = *ram.Mode
+		r.game.stop()
+		r.game = newGameMode(r.settings.Mode, r.gameHooks(), r.settings)
+		changed = true
+	}
+	r.game.configure(r.settings)
+	if ram.MaxPlayers != nil {
+		r.settings.MaxPlayers = *ram.MaxPlayers
+		changed = r.admitFromWaitlist() || changed
+	}
+	return changed
+}
+
+// what the game mode gets from the room
+func (r *Room) gameHooks() gameHooks {
+	return gameHooks{
+		broadcast: r.broadcastGameUpdate,
+		send:      r.sendGameUpdateTo,
+		sendError: r.sendErrorTo,
+		spectate:  r.moveToSpectators,
+		log:       r.log,
+		debug:     r.debugMode,
+	}
+}
+
+// is p the room owner
+func (r *Room) isOwner(p *Player) bool {
+	v, ok := r.players[p]
+	return ok && v == 0
+}
+
+// runs f on the room goroutine and waits for it, false if the room is closed
+func (r *Room) do(f func(*Room)) bool {
+	done := make(chan struct{})
+	select {
+	case r.requests <- func(r *Room) {
+		f(r)
+		close(done)
+	}:
+	case <-r.stopped:
+		return false
+	}
+	<-done
+	return true
+}
+
+// hands a room action to the room loop, false if the room is closed
+func (r *Room) sendRoomAction(ram RoomActionMessage) bool {
+	select {
+	case r.incomingRoomActions <- ram:
+		return true
+	case <-r.stopped:
+		return false
+	}
+}
+
+// hands a game action to the room loop, false if the room is closed
+func (r *Room) sendGameAction(tgam TriviaGameActionMessage) bool {
+	select {
+	case r.incomingTriviaActions <- tgam:
+		return true
+	case <-r.stopped:
+		return false
+	}
+}
+
+// kicks everyone out and stops the room loop
+func (r *Room) shutdown(reason string) {
+	if r.closed {
+		return
+	}
+	for p := range r.players {
+		p.room = nil
+		p.queue(noticeHelper(reason))
+	}
+	for _, p := range append(r.pending, r.waitlist...) {
+		p.waiting = nil
+		p.queue(noticeHelper(reason))
 	}
+	r.players = make(map[*Player]int)
+	r.pending = nil
+	r.waitlist = nil
+	r.game.stop()
+	r.closed = true
+	close(r.stopped)
+	r.log.Info("room closed", "reason", reason)
 }
 
 // send error to player
@@ -109,13 +441,19 @@ func (r *Room) sendErrorTo(p *Player, msg string) {
 	if r.debugMode {
 		return
 	}
-	p.send <- serverErrorHelper(msg)
+	p.queue(serverErrorHelper(msg))
 }
 
-// launches trivia game
-func (r *Room) startGame() {
-	r.game.startGame()
+// launches trivia game, when teams aren't auto assigned it refuses to start
+// with unfair teams
+func (r *Room) startGame() error {
+	players := r.activePlayers()
+	if err := r.game.start(players); err != nil {
+		return err
+	}
+	r.log.Info("game started", "players", len(players), "mode", r.settings.Mode)
 	r.writeChat("Starting new game...")
+	return nil
 }
 
 // joins a player to the room
@@ -124,22 +462,45 @@ func (r *Room) join(p *Player) {
 	r.playernum++
 	p.room = r
 	p.roomname = fmt.Sprintf("Player %d", r.players[p])
+	r.log.Info("player joined", "player", p.id, "number", r.players[p])
 }
 
 // remove player from room and also game team
 func (r *Room) removePlayer(player *Player) {
 	if _, in := r.players[player]; in {
+		owner := r.isOwner(player)
 		player.room = nil
+		player.spectator = false
 		delete(r.players, player)
 
-		delete(r.game.blue, player)
-		delete(r.game.red, player)
+		r.game.removePlayer(player)
+		r.log.Info("player left", "player", player.id)
+
+		r.admitFromWaitlist()
+		if owner {
+			r.passOwnership()
+		}
+	}
+}
+
+// hands the room to whoever has been in it longest, players before spectators
+func (r *Room) passOwnership() {
+	var heir *Player
+	for p, n := range r.players {
+		if heir == nil || (heir.spectator && !p.spectator) || (heir.spectator == p.spectator && n < r.players[heir]) {
+			heir = p
+		}
+	}
+	if heir == nil {
+		return
 	}
+	r.players[heir] = 0
+	heir.queue(noticeHelper("You are now the room owner"))
+	r.log.Info("ownership passed", "player", heir.id)
 }
 
 func (r *Room) writeChat(msg string) {
 	r.chat = append(r.chat, msg)
-	//fmt.Println(r.chat)
 }
 
 // lets clients know about room updates
@@ -149,24 +510,45 @@ func (r *Room) broadcastRoomUpdate(created bool) {
 	}
 
 	playerlist := []string{}
+	spectators := []string{}
 	for p := range r.players {
-		playerlist = append(playerlist, p.roomname)
+		if p.spectator {
+			spectators = append(spectators, p.roomname)
+		} else {
+			playerlist = append(playerlist, p.roomname)
+		}
+	}
+	waitlist := []string{}
+	for _, p := range r.waitlist {
+		waitlist = append(waitlist, p.name)
 	}
 	rum := RoomUpdateMessage{
-		Code:    r.code,
-		Players: playerlist,
-		Chat:    r.chat,
+		Code:       r.code,
+		Players:    playerlist,
+		Chat:       r.chat,
+		Settings:   r.settings,
+		Waitlist:   waitlist,
+		Spectators: spectators,
 	}
 	if created {
 		tmp := true
 		rum.Created = &tmp
 	}
 	str, _ := json.Marshal(rum)
+
+	// only the owner sees who is waiting to get in
+	rum.Pending = r.pendingList()
+	ownerstr, _ := json.Marshal(rum)
+
 	for player := range r.players {
-		player.send <- OutgoingMessage{
-			Type:    RoomUpdate,
-			Content: str,
+		content := str
+		if r.isOwner(player) {
+			content = ownerstr
 		}
+		player.queue(OutgoingMessage{
+			Type:    RoomUpdate,
+			Content: content,
+		})
 	}
 }
 
@@ -178,9 +560,24 @@ func (r *Room) broadcastGameUpdate(tsum TriviaStateUpdateMessage) {
 
 	for p := range r.players {
 		str, _ := json.Marshal(tsum)
-		p.send <- OutgoingMessage{
+		p.queue(OutgoingMessage{
 			Type:    TriviaGameUpdate,
 			Content: str,
-		}
+		})
+	}
+}
+
+// game update for one player, like their team's votes
+func (r *Room) sendGameUpdateTo(p *Player, tsum TriviaStateUpdateMessage) {
+	if r.debugMode {
+		return
+	}
+	if _, in := r.players[p]; !in {
+		return
 	}
+	str, _ := json.Marshal(tsum)
+	p.queue(OutgoingMessage{
+		Type:    TriviaGameUpdate,
+		Content: str,
+	})
 }
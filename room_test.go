@@ -2,12 +2,18 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
+// the room's game as the trivia implementation
+func triviaOf(r *Room) *TriviaGame {
+	return r.game.(*TriviaGame)
+}
+
 func TestStart(t *testing.T) {
 	room := newRoom("test", true)
-	if room.game.state == InRound {
+	if room.game.roundState() == InRound {
 		t.Fatalf("Room should start in Limbo")
 	}
 	pl0 := &Player{} // admin
@@ -18,10 +24,10 @@ func TestStart(t *testing.T) {
 	// only admin can start room
 	sm := RoomActionMessage{}
 	sm.from = pl1
-	sm.Start = boolPtr(true)
+	sm.Start = ptr(true)
 	room.incomingRoomActions <- sm
 	room.run()
-	if room.game.state == InRound {
+	if room.game.roundState() == InRound {
 		t.Fatalf("Game was started but only admin should be able to start game")
 	}
 
@@ -29,7 +35,7 @@ func TestStart(t *testing.T) {
 	sm.from = pl0
 	room.incomingRoomActions <- sm
 	room.run()
-	if room.game.state == InLimbo {
+	if room.game.roundState() == InLimbo {
 		t.Fatalf("Admin should be able to start game")
 	}
 }
@@ -52,30 +58,541 @@ func TestLeave(t *testing.T) {
 	room.run()
 	//fmt.Println(room.players)
 
-	if len(room.players) != 0 || len(room.game.blue) != 0 || len(room.game.red) != 0 {
+	if len(room.players) != 0 || triviaOf(room).teamOf(&pl) != nil {
 		t.Errorf("Player list should be empty")
 	}
 
 }
 
+func TestOwnerLeaves(t *testing.T) {
+	room := newRoom("test", true)
+	owner, watcher, pl := &Player{}, &Player{}, &Player{}
+	room.join(owner)
+	room.join(watcher)
+	room.join(pl)
+	watcher.spectator = true
+
+	room.removePlayer(owner)
+	if !room.isOwner(pl) || room.isOwner(watcher) {
+		t.Fatal("Ownership should pass to the longest playing player")
+	}
+}
+
 func TestRoundsRotateFromRoundToLimbo(t *testing.T) {
 	room := newRoom("test", true)
 	pl := &Player{}
 	room.join(pl)
 	room.startGame()
-	if room.game.state != InRound {
+	if room.game.roundState() != InRound {
 		t.Fatalf("Should be in Round before starting flip flop test")
 	}
 	fmt.Println("Waiting for round timer...")
-	room.run() //  go until round timer, should switch to limbo
-	if room.game.state != InLimbo {
+	// go until round timer, should switch to limbo. hints for free text
+	// questions also wake the loop during the round
+	for room.game.roundState() == InRound {
+		room.run()
+	}
+	if room.game.roundState() != InLimbo {
 		t.Fatalf("Did not go to Limbo after timer went off")
 	}
 	fmt.Println("Waiting for limbo timer...")
 	room.run() //  go until round timer, should switch to round
-	if room.game.state != InRound {
+	if room.game.roundState() != InRound {
 		t.Fatalf("Did not go to Round after timer went off")
 	}
 	fmt.Println("Finished 1 round to limbo rotation")
 
 }
+
+func TestRoomCodes(t *testing.T) {
+	hub := newHub()
+	for i := 0; i < 50; i++ {
+		code := hub.newRoomCode()
+		if len(code) != roomCodeLength || strings.ContainsAny(code, "ILO01") {
+			t.Fatalf("Bad room code %q", code)
+		}
+		hub.rooms[code] = newRoom(code, true)
+	}
+	if len(hub.rooms) != 50 {
+		t.Fatalf("Room codes collided")
+	}
+
+	// joins are case insensitive
+	var code string
+	for c := range hub.rooms {
+		code = c
+	}
+	pl := &Player{}
+	hub.joinRoom(pl, JoinRoomMessage{Code: " " + strings.ToLower(code)})
+	ram := <-hub.rooms[code].incomingRoomActions
+	if ram.from != pl || ram.Join == nil || !*ram.Join {
+		t.Fatalf("Lower case code did not join the room")
+	}
+
+	// invite links only count as joinable when nothing else is needed
+	room := hub.rooms[code]
+	if info := room.inviteInfo(); !info.Joinable {
+		t.Fatalf("Open room should be joinable, got %+v", info)
+	}
+	room.settings.InviteOnly = true
+	if info := room.inviteInfo(); info.Joinable || !info.InviteOnly {
+		t.Fatalf("Invite only room should not be joinable from the link, got %+v", info)
+	}
+}
+
+func TestQuickPlay(t *testing.T) {
+	hub := newHub()
+	open := newRoom("OPEN1", true)
+	open.settings.Public = true
+	open.join(&Player{})
+	open.publishListing()
+	hub.rooms[open.code] = open
+	private := newRoom("PRIV1", true)
+	private.join(&Player{})
+	private.publishListing()
+	hub.rooms[private.code] = private
+
+	empty := newRoom("EMPT1", true)
+	empty.settings.Public = true
+	empty.publishListing()
+	hub.rooms[empty.code] = empty
+
+	if list := hub.publicRooms(); len(list) != 1 || list[0].Code != "OPEN1" {
+		t.Fatalf("Only the public lobby with players should be listed, got %+v", list)
+	}
+
+	// quick play fills the open room
+	pl := &Player{}
+	hub.quickPlay(pl)
+	if ram := <-open.incomingRoomActions; ram.from != pl {
+		t.Fatalf("Quick play did not join the open room")
+	}
+
+	// no public rooms in the lobby, quick play makes one
+	open.startGame()
+	open.publishListing()
+	pl = &Player{}
+	hub.quickPlay(pl)
+	if pl.room == nil || pl.room == open || !pl.room.settings.Public {
+		t.Fatalf("Quick play should have created a new public room")
+	}
+}
+
+func TestPasswordAndInviteOnly(t *testing.T) {
+	room := newRoom("test", true)
+	owner := &Player{id: "owner"}
+	room.join(owner)
+
+	// owner sets a password
+	ram := RoomActionMessage{}
+	ram.from = owner
+	pw := "hunter2"
+	ram.Password = &pw
+	room.incomingRoomActions <- ram
+	room.run()
+	if !room.settings.HasPassword || room.checkPassword("wrong") || !room.checkPassword("hunter2") {
+		t.Fatalf("Room password was not set")
+	}
+	if string(room.password.hash) == pw {
+		t.Fatalf("Password should be stored hashed")
+	}
+
+	// invite only queues joins until the owner approves
+	ram = RoomActionMessage{}
+	ram.from = owner
+	ram.InviteOnly = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+
+	guest := &Player{id: "guest"}
+	ram = RoomActionMessage{}
+	ram.from = guest
+	ram.Join = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+	if _, in := room.players[guest]; in || guest.waiting != room || len(room.pending) != 1 {
+		t.Fatalf("Guest should be waiting for approval")
+	}
+
+	ram = RoomActionMessage{}
+	ram.from = owner
+	ram.Approve = &guest.id
+	room.incomingRoomActions <- ram
+	room.run()
+	if _, in := room.players[guest]; !in || guest.waiting != nil || len(room.pending) != 0 {
+		t.Fatalf("Approved guest should have joined")
+	}
+}
+
+func TestCapacityAndWaitlist(t *testing.T) {
+	room := newRoom("test", true)
+	room.settings.MaxPlayers = 2
+	room.settings.MaxTeamSize = 1
+	room.game.configure(room.settings)
+	pl0 := &Player{id: "0"}
+	pl1 := &Player{id: "1"}
+	pl2 := &Player{id: "2"}
+	for _, p := range []*Player{pl0, pl1, pl2} {
+		ram := RoomActionMessage{}
+		ram.from = p
+		ram.Join = ptr(true)
+		room.incomingRoomActions <- ram
+		room.run()
+	}
+	if len(room.players) != 2 || len(room.waitlist) != 1 || pl2.waiting != room {
+		t.Fatalf("Third player should be on the waitlist")
+	}
+
+	// a waitlisted player can give up their spot but do nothing else
+	pl3 := &Player{id: "3"}
+	ram := RoomActionMessage{}
+	ram.from = pl3
+	ram.Join = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+	chat := "let me in"
+	ram = RoomActionMessage{}
+	ram.from = pl3
+	ram.Chat = &chat
+	room.incomingRoomActions <- ram
+	room.run()
+	ram = RoomActionMessage{}
+	ram.from = pl3
+	ram.Leave = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+	if len(room.chat) != 0 || len(room.waitlist) != 1 || pl3.waiting != nil {
+		t.Fatalf("Waitlisted player should only be able to leave the queue")
+	}
+
+	// team size limit
+	for _, p := range []*Player{pl0, pl1} {
+		tgam := TriviaGameActionMessage{}
+		tgam.from = p
+		tgam.Join = new(int)
+		room.incomingTriviaActions <- tgam
+		room.run()
+	}
+	if blue := triviaOf(room).teams[0].members; len(blue) != 1 || !blue[pl0] {
+		t.Fatalf("Blue team should be capped at 1 player")
+	}
+
+	// a leaving player lets the waitlist in
+	ram = RoomActionMessage{}
+	ram.from = pl0
+	ram.Leave = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+	if _, in := room.players[pl2]; !in || len(room.waitlist) != 0 || pl2.waiting != nil {
+		t.Fatalf("Waitlisted player should have been let in")
+	}
+}
+
+func TestModeration(t *testing.T) {
+	room := newRoom("test", true)
+	owner := &Player{id: "owner"}
+	troll := &Player{id: "troll", identity: &Identity{Subject: "troll@example"}}
+	room.join(owner)
+	room.join(troll)
+
+	ram := RoomActionMessage{}
+	ram.from = owner
+	ram.Mute = &troll.roomname
+	room.incomingRoomActions <- ram
+	room.run()
+
+	chat := "spam"
+	ram = RoomActionMessage{}
+	ram.from = troll
+	ram.Chat = &chat
+	room.incomingRoomActions <- ram
+	room.run()
+	for _, line := range room.chat {
+		if strings.Contains(line, "spam") {
+			t.Fatalf("Muted player was able to chat")
+		}
+	}
+
+	// leaving and coming back doesn't clear the mute
+	room.removePlayer(troll)
+	room.join(troll)
+	room.incomingRoomActions <- ram
+	room.run()
+	for _, line := range room.chat {
+		if strings.Contains(line, "spam") {
+			t.Fatalf("Muted player was able to chat after rejoining")
+		}
+	}
+
+	ram = RoomActionMessage{}
+	ram.from = owner
+	ram.Ban = &troll.roomname
+	room.incomingRoomActions <- ram
+	room.run()
+	if _, in := room.players[troll]; in {
+		t.Fatalf("Banned player is still in the room")
+	}
+	if last := room.chat[len(room.chat)-1]; !strings.HasPrefix(last, systemChatPrefix) {
+		t.Errorf("Ban should be logged in chat, got %q", last)
+	}
+
+	// same identity on a new connection is still banned
+	hub := newHub()
+	hub.rooms[room.code] = room
+	hub.joinRoom(&Player{id: "troll2", identity: &Identity{Subject: "troll@example"}}, JoinRoomMessage{Code: room.code})
+	if len(room.incomingRoomActions) != 0 {
+		t.Fatalf("Banned identity was allowed to join")
+	}
+}
+
+func TestSpectators(t *testing.T) {
+	room := newRoom("test", true)
+	room.settings.MaxPlayers = 1
+	owner := &Player{id: "owner"}
+	room.join(owner)
+
+	// spectators don't take player spots
+	watcher := &Player{id: "watcher"}
+	ram := RoomActionMessage{}
+	ram.from = watcher
+	ram.Join = ptr(true)
+	ram.Spectate = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+	if _, in := room.players[watcher]; !in || !watcher.spectator || room.playerCount() != 1 {
+		t.Fatalf("Spectator should be in the room without counting as a player")
+	}
+
+	// spectators can't join teams
+	tgam := TriviaGameActionMessage{}
+	tgam.from = watcher
+	tgam.Join = new(int)
+	room.incomingTriviaActions <- tgam
+	room.run()
+	if triviaOf(room).teamOf(watcher) != nil {
+		t.Fatalf("Spectator joined a team")
+	}
+
+	// can't become a player while the room is full
+	ram = RoomActionMessage{}
+	ram.from = watcher
+	ram.Spectate = ptr(false)
+	room.incomingRoomActions <- ram
+	room.run()
+	if !watcher.spectator {
+		t.Fatalf("Spectator took a player spot in a full room")
+	}
+
+	// joining again from inside the room changes nothing
+	ram = RoomActionMessage{}
+	ram.from = owner
+	ram.Join = ptr(true)
+	ram.Spectate = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+	if !room.isOwner(owner) || owner.spectator {
+		t.Fatalf("Owner should keep their spot when sending join again")
+	}
+}
+
+func TestTeamBalancing(t *testing.T) {
+	room := newRoom("test", true)
+	players := []*Player{{}, {}, {}, {}, {}}
+	for _, p := range players {
+		room.join(p)
+		triviaOf(room).teams[0].members[p] = true
+	}
+
+	// refuses a 5v0 game without auto assignment
+	room.settings.AutoAssignTeams = false
+	room.game.configure(room.settings)
+	if err := room.startGame(); err != errEmptyTeam || room.game.roundState() != InLobby {
+		t.Fatalf("Game should not start with an empty team, got %v", err)
+	}
+
+	// owner balances the teams
+	ram := RoomActionMessage{}
+	ram.from = players[0]
+	ram.Balance = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+	blue, red := triviaOf(room).teams[0].members, triviaOf(room).teams[1].members
+	if len(blue) != 3 || len(red) != 2 {
+		t.Fatalf("Teams should be 3v2 after balancing, got %dv%d", len(blue), len(red))
+	}
+	if err := room.startGame(); err != nil {
+		t.Fatalf("Balanced game should start, got %v", err)
+	}
+}
+
+func TestMoreTeams(t *testing.T) {
+	room := newRoom("test", true)
+	owner := &Player{}
+	room.join(owner)
+
+	ram := RoomActionMessage{}
+	ram.from = owner
+	four := 4
+	ram.Teams = &four
+	room.incomingRoomActions <- ram
+	room.run()
+	if len(triviaOf(room).teams) != 4 || triviaOf(room).teams[3].name != "Yellow" {
+		t.Fatalf("Room should have 4 teams")
+	}
+
+	// join the last team
+	tgam := TriviaGameActionMessage{}
+	tgam.from = owner
+	three := 3
+	tgam.Join = &three
+	room.incomingTriviaActions <- tgam
+	room.run()
+	if triviaOf(room).teamOf(owner) != triviaOf(room).teams[3] {
+		t.Fatalf("Owner should be on team 3")
+	}
+
+	// dropping back to 2 teams unassigns them
+	two := 2
+	ram.Teams = &two
+	room.incomingRoomActions <- ram
+	room.run()
+	if len(triviaOf(room).teams) != 2 || triviaOf(room).teamOf(owner) != nil {
+		t.Fatalf("Owner should be unassigned after their team was removed")
+	}
+}
+
+func TestSwitchGameMode(t *testing.T) {
+	room := newRoom("test", true)
+	owner := &Player{}
+	room.join(owner)
+
+	ram := RoomActionMessage{}
+	ram.from = owner
+	mode := FreeForAllMode
+	ram.Mode = &mode
+	room.incomingRoomActions <- ram
+	room.run()
+	if room.settings.Mode != FreeForAllMode || room.game.snapshot(false).Mode != FreeForAllMode {
+		t.Fatalf("Room should be running free for all")
+	}
+
+	unknown := "nope"
+	ram.Mode = &unknown
+	room.incomingRoomActions <- ram
+	room.run()
+	if room.settings.Mode != FreeForAllMode {
+		t.Fatalf("Unknown mode should be rejected")
+	}
+
+	// free for all has no teams to balance
+	ram = RoomActionMessage{}
+	ram.from = owner
+	ram.Balance = ptr(true)
+	room.incomingRoomActions <- ram
+	room.run()
+	if triviaOf(room).teamOf(owner) != nil {
+		t.Fatalf("Balancing should not put free for all players on teams")
+	}
+}
+
+func TestCaptains(t *testing.T) {
+	room := newRoom("test", true)
+	owner, pl1, pl2 := &Player{}, &Player{}, &Player{}
+	game := triviaOf(room)
+	game.teamAnswer = TeamAnswerCaptain
+	for _, p := range []*Player{owner, pl1, pl2} {
+		room.join(p)
+		game.teams[0].add(p)
+	}
+	if game.teams[0].captain() != owner {
+		t.Fatal("First joiner should captain until someone is chosen")
+	}
+
+	// two of three teammates elect pl1
+	game.handleAction(&TriviaGameActionMessage{ActionMessage: ActionMessage{from: pl1}, Elect: &pl1.roomname})
+	if game.teams[0].captain() != owner {
+		t.Fatal("One vote out of three should not elect a captain")
+	}
+	game.handleAction(&TriviaGameActionMessage{ActionMessage: ActionMessage{from: pl2}, Elect: &pl1.roomname})
+	if game.teams[0].captain() != pl1 || !game.speaksForTeam(pl1) || game.speaksForTeam(owner) {
+		t.Fatal("Majority vote should make pl1 captain")
+	}
+
+	// owner hands it to pl2
+	ram := RoomActionMessage{}
+	ram.from = owner
+	ram.Captain = &pl2.roomname
+	room.incomingRoomActions <- ram
+	room.run()
+	if game.teams[0].captain() != pl2 {
+		t.Fatal("Owner should be able to assign a captain")
+	}
+
+	// captaincy moves on when the captain leaves
+	room.removePlayer(pl2)
+	if c := game.teams[0].captain(); c == nil || c == pl2 {
+		t.Fatal("Captaincy should pass to a teammate")
+	}
+}
+
+func TestDisconnectAdmitsFromWaitlist(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+	owner := &Player{id: "owner", send: make(chan OutgoingMessage, 256)}
+	waiting := &Player{id: "waiting", send: make(chan OutgoingMessage, 256)}
+	hub.do(func(h *Hub) {
+		h.players[owner] = true
+		h.players[waiting] = true
+		h.createRoom(owner, defaultRoomSettings())
+	})
+	room := owner.room
+	room.do(func(r *Room) {
+		r.settings.MaxPlayers = 1
+		r.admit(waiting)
+	})
+
+	hub.unregister <- owner
+	joined := false
+	hub.do(func(h *Hub) {}) // wait for the hub to finish the disconnect
+	room.do(func(r *Room) { _, joined = r.players[waiting] })
+	if !joined || waiting.waiting != nil {
+		t.Fatal("Waitlisted player should join when someone disconnects")
+	}
+}
+
+func TestDisconnectRacesAdmit(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		hub := newHub()
+		go hub.run()
+		owner := &Player{id: "owner", send: make(chan OutgoingMessage, 256)}
+		waiting := &Player{id: "waiting", send: make(chan OutgoingMessage, 256), done: make(chan struct{})}
+		hub.do(func(h *Hub) {
+			h.players[owner] = true
+			h.players[waiting] = true
+			h.createRoom(owner, defaultRoomSettings())
+		})
+		room := owner.room
+		room.do(func(r *Room) { r.settings.MaxPlayers = 1 })
+		hub.do(func(h *Hub) { h.joinRoom(waiting, JoinRoomMessage{Code: room.code}) })
+
+		// a spot opens up while the waitlisted player disconnects
+		opened := make(chan struct{})
+		go func() {
+			room.do(func(r *Room) {
+				r.settings.MaxPlayers = 2
+				r.admitFromWaitlist()
+			})
+			close(opened)
+		}()
+		hub.unregister <- waiting
+		<-opened
+		hub.do(func(h *Hub) {})
+
+		room.do(func(r *Room) {
+			_, joined := r.players[waiting]
+			if joined || len(r.waitlist) != 0 {
+				t.Fatal("Disconnected player should not stay in the room or on the waitlist")
+			}
+		})
+	}
+}
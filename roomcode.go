@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// room code characters, no I/L/1 or O/0 so codes are easy to read out loud
+const roomCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const roomCodeLength = 5
+
+// outgoing, answer to the /join/{code} invite endpoint
+type InviteInfo struct {
+	Code   string `json:"code"`
+	Exists bool   `json:"exists"`
+
+	// the link alone gets you in, no password, approval or waitlist
+	Joinable bool `json:"joinable"`
+
+	HasPassword bool   `json:"hasPassword"`
+	InviteOnly  bool   `json:"inviteOnly"`
+	Full        bool   `json:"full"`
+	Players     int    `json:"players"`
+	State       string `json:"state,omitempty"`
+}
+
+func randomRoomCode() string {
+	b := make([]byte, roomCodeLength)
+	max := big.NewInt(int64(len(roomCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = roomCodeAlphabet[n.Int64()]
+	}
+	return string(b)
+}
+
+// codes are case insensitive, stored upper case
+func normalizeRoomCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// picks a code that isn't used by another room, must run on the hub goroutine
+func (h *Hub) newRoomCode() string {
+	for {
+		code := randomRoomCode()
+		if _, in := h.rooms[code]; !in {
+			return code
+		}
+	}
+}
+
+// must run on the room goroutine
+func (r *Room) inviteInfo() InviteInfo {
+	full := r.full()
+	return InviteInfo{
+		Code:        r.code,
+		Exists:      true,
+		Joinable:    !r.settings.HasPassword && !r.settings.InviteOnly && !full,
+		HasPassword: r.settings.HasPassword,
+		InviteOnly:  r.settings.InviteOnly,
+		Full:        full,
+		Players:     r.playerCount(),
+		State:       r.game.roundState().String(),
+	}
+}
+
+// serves /join/{code}, tells an invite link whether its room can be joined
+func serveInvite(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	code := normalizeRoomCode(r.PathValue("code"))
+	info := InviteInfo{Code: code}
+	if room := hub.lookupRoom(code); room != nil {
+		room.do(func(r *Room) { info = r.inviteInfo() })
+	}
+	status := http.StatusOK
+	if !info.Exists {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, info)
+}
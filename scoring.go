@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// scoring formulas a room can pick
+const (
+	ScoringFlat   = "flat"   // same points however fast, free for all keeps its speedBonus
+	ScoringLinear = "linear" // bonus shrinks steadily over the round
+	ScoringTiered = "tiered" // bonus by which quarter of the round the answer came in
+)
+
+// most bonus points for an instant answer with linear scoring
+const LinearSpeedBonus = 100
+
+// tiered bonus for answers in the first, second and third quarter of the round
+var speedTiers = []int{50, 25, 10}
+
+// bonus points for a correct answer given how far into the round it came
+var scoringFormulas = map[string]func(elapsed, roundTime time.Duration) int{
+	ScoringFlat: func(time.Duration, time.Duration) int {
+		return 0
+	},
+	ScoringLinear: func(elapsed, roundTime time.Duration) int {
+		if roundTime <= 0 || elapsed >= roundTime {
+			return 0
+		}
+		return int(float64(LinearSpeedBonus) * float64(roundTime-elapsed) / float64(roundTime))
+	},
+	ScoringTiered: func(elapsed, roundTime time.Duration) int {
+		for i, bonus := range speedTiers {
+			if elapsed < roundTime*time.Duration(i+1)/4 {
+				return bonus
+			}
+		}
+		return 0
+	},
+}
+
+// outgoing, a player's answer last round
+type AnswerState struct {
+	Player  string `json:"player"`
+	Correct bool   `json:"correct"`
+
+	// since the round started
+	TimeMs int64 `json:"timeMs"`
+
+	Points int `json:"points"`
+}
+
+// points for a correct answer that came in elapsed into the round, unknown
+// formulas score flat
+func (t *TriviaGame) answerPoints(elapsed time.Duration) int {
+	points := CorrectAnswerPoints
+	if formula, ok := scoringFormulas[t.scoring]; ok {
+		points += formula(elapsed, t.roundTime)
+	}
+	return points
+}
+
+// free for all bonus for the rank-th correct answer, only when no speed
+// formula already rewards fast answers
+func (t *TriviaGame) placementBonus(rank int) int {
+	if !t.freeForAll || rank >= len(speedBonus) {
+		return 0
+	}
+	if t.scoring != ScoringFlat && scoringFormulas[t.scoring] != nil {
+		return 0
+	}
+	return speedBonus[rank]
+}
+
+// points for p's correct answer, less for every hint that was out when they
+// answered
+func (t *TriviaGame) pointsFor(p *Player) int {
+	return max(t.answerPoints(t.guessTimes[p])-HintPenalty*t.guessHints[p], 0)
+}
+
+// last round's answers, fastest first
+func (t *TriviaGame) answerStates() []AnswerState {
+	answers := []AnswerState{}
+	if t.question == nil {
+		return answers
+	}
+	for _, p := range t.guessOrder {
+		answers = append(answers, AnswerState{
+			Player:  p.roomname,
+			Correct: t.correctGuess(p),
+			TimeMs:  t.guessTimes[p].Milliseconds(),
+			Points:  t.roundPoints[p],
+		})
+	}
+	sort.SliceStable(answers, func(i, j int) bool { return answers[i].TimeMs < answers[j].TimeMs })
+	return answers
+}
@@ -0,0 +1,58 @@
+package main
+
+// spectators sit in Room.players so they get every broadcast, but they don't
+// play and don't count towards MaxPlayers
+
+func (r *Room) spectatorCount() int {
+	n := 0
+	for p := range r.players {
+		if p.spectator {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Room) spectatorsFull() bool {
+	return r.settings.MaxSpectators > 0 && r.spectatorCount() >= r.settings.MaxSpectators
+}
+
+// moves a player in the room between playing and spectating, only allowed in
+// the lobby. returns true if the player's role changed
+func (r *Room) setSpectating(p *Player, spectate bool) bool {
+	if _, in := r.players[p]; !in || p.spectator == spectate {
+		return false
+	}
+	if r.game.roundState() != InLobby {
+		r.sendErrorTo(p, "You can only switch roles in the lobby")
+		return false
+	}
+	if spectate {
+		if r.spectatorsFull() {
+			r.sendErrorTo(p, "There are no spectator spots left")
+			return false
+		}
+		p.spectator = true
+		r.game.removePlayer(p)
+		r.admitFromWaitlist()
+	} else {
+		if r.full() {
+			r.sendErrorTo(p, "The room is full")
+			return false
+		}
+		p.spectator = false
+	}
+	r.log.Info("player switched role", "player", p.id, "spectator", spectate)
+	return true
+}
+
+// game modes move players between playing and spectating mid game, unlike
+// setSpectating this skips the lobby and capacity checks
+func (r *Room) moveToSpectators(p *Player, spectate bool) {
+	if _, in := r.players[p]; !in || p.spectator == spectate {
+		return
+	}
+	p.spectator = spectate
+	r.log.Info("player switched role", "player", p.id, "spectator", spectate)
+	r.broadcastRoomUpdate(false)
+}
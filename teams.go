@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sort"
+)
+
+const (
+	MinTeams     = 2
+	MaxTeams     = 8
+	DefaultTeams = 2
+)
+
+var (
+	errUnassignedPlayers = errors.New("Everyone needs to pick a team")
+	errEmptyTeam         = errors.New("Every team needs at least one player")
+	errLopsidedTeams     = errors.New("Teams are too lopsided")
+)
+
+// names and colors handed out to teams in order
+var teamPresets = []struct {
+	name  string
+	color string
+}{
+	{"Blue", "#2f6fdf"},
+	{"Red", "#df2f2f"},
+	{"Green", "#2fa84f"},
+	{"Yellow", "#e0b000"},
+	{"Purple", "#8a3fd1"},
+	{"Orange", "#f07c1f"},
+	{"Pink", "#e0529c"},
+	{"Teal", "#1fa6a6"},
+}
+
+type Team struct {
+	name  string
+	color string
+
+	// playerlist
+	members map[*Player]bool
+
+	// members in the order they joined the team
+	order []*Player
+
+	// captain picked by election or by the owner, nil falls back to the
+	// first joiner
+	chosen *Player
+
+	// captain election, teammate to who they voted for
+	elections map[*Player]*Player
+
+	// score
+	score int
+}
+
+// outgoing, a team in the state update
+type TeamState struct {
+	Name    string   `json:"name"`
+	Color   string   `json:"color"`
+	Players []string `json:"players"`
+	Score   int      `json:"score"`
+
+	// empty for an empty team
+	Captain string `json:"captain"`
+}
+
+func newTeams(n int) []*Team {
+	teams := []*Team{}
+	for i := 0; i < n; i++ {
+		teams = append(teams, &Team{
+			name:      teamPresets[i].name,
+			color:     teamPresets[i].color,
+			members:   make(map[*Player]bool),
+			elections: make(map[*Player]*Player),
+		})
+	}
+	return teams
+}
+
+func (team *Team) add(p *Player) {
+	if team.members[p] {
+		return
+	}
+	team.members[p] = true
+	team.order = append(team.order, p)
+}
+
+func (team *Team) remove(p *Player) {
+	if !team.members[p] {
+		return
+	}
+	delete(team.members, p)
+	for i, member := range team.order {
+		if member == p {
+			team.order = append(team.order[:i], team.order[i+1:]...)
+			break
+		}
+	}
+	// captaincy passes to the longest serving teammate
+	if team.chosen == p {
+		team.chosen = nil
+	}
+	delete(team.elections, p)
+	for voter, candidate := range team.elections {
+		if candidate == p {
+			delete(team.elections, voter)
+		}
+	}
+}
+
+// the chosen captain or the team's first joiner, nil for an empty team
+func (team *Team) captain() *Player {
+	if team.chosen != nil {
+		return team.chosen
+	}
+	if len(team.order) == 0 {
+		return nil
+	}
+	return team.order[0]
+}
+
+func (team *Team) state() TeamState {
+	s := TeamState{
+		Name:    team.name,
+		Color:   team.color,
+		Players: []string{},
+		Score:   team.score,
+	}
+	for p := range team.members {
+		s.Players = append(s.Players, p.roomname)
+	}
+	sort.Strings(s.Players)
+	if c := team.captain(); c != nil {
+		s.Captain = c.roomname
+	}
+	return s
+}
+
+// players who can be on a team, in join order
+func (r *Room) activePlayers() []*Player {
+	list := []*Player{}
+	for p := range r.players {
+		if !p.spectator {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return r.players[list[i]] < r.players[list[j]] })
+	return list
+}
+
+func (t *TriviaGame) hasTeams() bool {
+	return !t.freeForAll
+}
+
+// team the player is on, nil if none
+func (t *TriviaGame) teamOf(p *Player) *Team {
+	for _, team := range t.teams {
+		if team.members[p] {
+			return team
+		}
+	}
+	return nil
+}
+
+func (t *TriviaGame) leaveTeam(p *Player) {
+	for _, team := range t.teams {
+		team.remove(p)
+	}
+}
+
+// changes the number of teams, players on removed teams become unassigned
+func (t *TriviaGame) setTeamCount(n int) {
+	if n < len(t.teams) {
+		t.teams = t.teams[:n]
+		return
+	}
+	t.teams = append(t.teams, newTeams(n)[len(t.teams):]...)
+}
+
+// smallest team, earliest on a tie
+func (t *TriviaGame) smallestTeam() *Team {
+	small := t.teams[0]
+	for _, team := range t.teams[1:] {
+		if len(team.members) < len(small.members) {
+			small = team
+		}
+	}
+	return small
+}
+
+// largest team, earliest on a tie
+func (t *TriviaGame) largestTeam() *Team {
+	big := t.teams[0]
+	for _, team := range t.teams[1:] {
+		if len(team.members) > len(big.members) {
+			big = team
+		}
+	}
+	return big
+}
+
+// puts unassigned players on the smallest team, then moves the newest member
+// of the biggest team to the smallest until team sizes differ by at most one
+func (t *TriviaGame) balanceTeams(players []*Player) {
+	for _, p := range players {
+		if t.teamOf(p) != nil {
+			continue
+		}
+		small := t.smallestTeam()
+		if t.maxTeamSize > 0 && len(small.members) >= t.maxTeamSize {
+			break
+		}
+		small.add(p)
+	}
+	for {
+		small, big := t.smallestTeam(), t.largestTeam()
+		if len(big.members)-len(small.members) <= 1 {
+			break
+		}
+		var newest *Player
+		for i := len(players) - 1; i >= 0 && newest == nil; i-- {
+			if big.members[players[i]] {
+				newest = players[i]
+			}
+		}
+		if newest == nil {
+			break
+		}
+		big.remove(newest)
+		small.add(newest)
+	}
+}
+
+// deals players onto teams in a random order, players who don't fit under the
+// team size limit are left without a team
+func (t *TriviaGame) shuffleTeams(players []*Player) {
+	shuffled := append([]*Player{}, players...)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	for _, team := range t.teams {
+		team.members = make(map[*Player]bool)
+		team.order = nil
+		team.chosen = nil
+		team.elections = make(map[*Player]*Player)
+	}
+	for i, p := range shuffled {
+		if t.maxTeamSize > 0 && i >= t.maxTeamSize*len(t.teams) {
+			break
+		}
+		t.teams[i%len(t.teams)].add(p)
+	}
+}
+
+// checks the teams are fair enough to start without auto assignment
+func (t *TriviaGame) checkTeams(players []*Player) error {
+	for _, p := range players {
+		if t.teamOf(p) == nil {
+			return errUnassignedPlayers
+		}
+	}
+	small, big := t.smallestTeam(), t.largestTeam()
+	if len(small.members) == 0 {
+		return errEmptyTeam
+	}
+	if len(big.members)-len(small.members) > 1 {
+		return errLopsidedTeams
+	}
+	return nil
+}
+
+func (t *TriviaGame) teamStates() []TeamState {
+	states := []TeamState{}
+	for _, team := range t.teams {
+		states = append(states, team.state())
+	}
+	return states
+}
+
+// owner only balance or shuffle from the lobby, returns true if teams changed
+func (r *Room) arrangeTeams(ram RoomActionMessage) bool {
+	balance := ram.Balance != nil && *ram.Balance
+	shuffle := ram.Shuffle != nil && *ram.Shuffle
+	if !balance && !shuffle {
+		return false
+	}
+	if !r.isOwner(ram.from) {
+		r.sendErrorTo(ram.from, "Only the owner can arrange teams")
+		return false
+	}
+	arranger, ok := r.game.(teamArranger)
+	if !ok || !arranger.hasTeams() {
+		r.sendErrorTo(ram.from, "This game mode has no teams")
+		return false
+	}
+	if r.game.roundState() != InLobby {
+		r.sendErrorTo(ram.from, "Teams can only be arranged in the lobby")
+		return false
+	}
+	if shuffle {
+		arranger.shuffleTeams(r.activePlayers())
+		r.writeSystemChat("Teams were shuffled")
+	} else {
+		arranger.balanceTeams(r.activePlayers())
+		r.writeSystemChat("Teams were balanced")
+	}
+	return true
+}
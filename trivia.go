@@ -1,48 +1,154 @@
 package main
 
 import (
+	"log/slog"
+	"sort"
 	"time"
 )
 
 type RoundState int64
 
 const (
-	InLimbo RoundState = 0 // time between rounds
-	InRound RoundState = 1 // active play time
-	InLobby RoundState = 2 // team select
+	InLimbo  RoundState = 0 // time between rounds
+	InRound  RoundState = 1 // active play time
+	InLobby  RoundState = 2 // team select
+	InWager  RoundState = 3 // betting before the final question
+	InReveal RoundState = 4 // final answer and wagers shown
 )
 
+func (s RoundState) String() string {
+	switch s {
+	case InLimbo:
+		return "limbo"
+	case InRound:
+		return "round"
+	case InLobby:
+		return "lobby"
+	case InWager:
+		return "wager"
+	case InReveal:
+		return "reveal"
+	}
+	return "unknown"
+}
+
 // default time per round
 const DefaultTriviaRoundTime = 10
 
 // default time between rounds
 const DefaultTriviaLimboTime = 5
 
+// time to place wagers before the final question
+const DefaultWagerTime = 15
+
+// game modes a room can pick
+const (
+	TeamsMode      = "teams" // players score for their team
+	FreeForAllMode = "ffa"   // every player for themselves
+)
+
+// points for a correct answer
+const CorrectAnswerPoints = 100
+
+// free for all bonus for the first, second and third correct answers
+var speedBonus = []int{50, 25, 10}
+
+// outgoing, a player's individual score
+type LeaderboardEntry struct {
+	Player string `json:"player"`
+	Score  int    `json:"score"`
+}
+
 type TriviaGame struct {
 	// state of the current round, limbo or in round
 	state RoundState
 
-	// votes, map of player to their selected answer number
-	roundVotes map[*Player]int
+	// votes, map of player to their guess this round
+	roundVotes map[*Player]string
+
+	// players in the order their guesses arrived this round
+	guessOrder []*Player
+
+	// how long into the round each guess arrived
+	guessTimes map[*Player]time.Duration
+
+	// points each player earned last round, for the limbo breakdown
+	roundPoints map[*Player]int
+
+	// name of the scoring formula, see scoringFormulas
+	scoring string
+
+	// how a team's votes become the team's answer, see teamAnswerModes
+	teamAnswer string
+
+	// lifelines each team, or player in free for all, starts a game with
+	lifelineCounts LifelineCounts
+
+	// lifelines left this game, keyed by lifelineHolder
+	lifelinesLeft map[any]LifelineCounts
+
+	// what lifelines changed about this round for a player
+	overrides map[*Player]*questionOverride
+
+	// teams take turns picking the next category during limbo
+	draft bool
+
+	// team picking now, nil when nobody is drafting
+	draftTeam *Team
+
+	// categories on offer and the one picked so far
+	draftOffer []string
+	draftPick  string
+
+	// drafts so far this game, also decides whose turn is next
+	draftPicks []DraftPick
+
+	// active question, nil before the first round
+	question *Question
+
+	// where questions come from
+	bank QuestionBank
+
+	// questions already used this game
+	asked map[*Question]bool
+
+	// free for all, players score individually and teams are ignored
+	freeForAll bool
+
+	// individual scores, used in free for all
+	scores map[*Player]int
 
 	// rounds since game started
 	round int
 
-	// playerlist
-	blue map[*Player]bool
+	// regular rounds before the final wager round, 0 for endless rounds
+	rounds int
+
+	// is the current round the final one
+	final bool
 
-	// playerlist
-	red map[*Player]bool
+	// final round wagers, by player in free for all and by team otherwise
+	wagers     map[*Player]int
+	teamWagers map[*Team]int
 
-	// score
-	blueScore int
+	// wager time
+	wagerTime time.Duration
 
-	// score
-	redScore int
+	// teams in order, players pick one by index
+	teams []*Team
 
 	// assume this is always set
 	timer *time.Timer
 
+	// reveals hints during a round, stopped when there are none to give
+	hintTimer *time.Timer
+
+	// hints revealed this round
+	hints int
+
+	// hints that were out when each guess arrived
+	guessHints map[*Player]int
+
 	// is in test mode?
 	debugMode bool
 
@@ -52,47 +158,258 @@ type TriviaGame struct {
 	// limbo time
 	limboTime time.Duration
 
+	// when the current round started
+	roundStart time.Time
+
 	// room broadcaster
 	roomGameUpdateBroadcaster func(TriviaStateUpdateMessage)
+
+	// sends an error back to a single player through the room
+	roomErrorSender func(*Player, string)
+
+	// sends a state update to a single player through the room
+	roomGameUpdateSender func(*Player, TriviaStateUpdateMessage)
+
+	// most players allowed on a team, 0 for no limit
+	maxTeamSize int
+
+	// balance teams on start instead of refusing unfair teams
+	autoAssignTeams bool
+
+	// hooks for modes built on top of the trivia game, nil when unused.
+	// called right after a new round starts
+	onRoundStart func()
+
+	// called after a round is scored and limbo started
+	onRoundEnd func()
+
+	// picks the next round's question instead of the question bank
+	nextQuestion func() *Question
+
+	// scores the round instead of the default scoring
+	scorer func()
+
+	// adds mode specific state to every snapshot
+	extendSnapshot func(*TriviaStateUpdateMessage)
+
+	// logger, shared with the room
+	log *slog.Logger
+}
+
+func init() {
+	registerGameMode(TeamsMode, func(h gameHooks) GameMode {
+		return newTriviaGameWithHooks(h)
+	})
+	registerGameMode(FreeForAllMode, func(h gameHooks) GameMode {
+		g := newTriviaGameWithHooks(h)
+		g.freeForAll = true
+		return g
+	})
 }
 
-func newTriviaGame(broadcaster func(TriviaStateUpdateMessage), debug bool) *TriviaGame {
+// trivia game wired up to a room
+func newTriviaGameWithHooks(h gameHooks) *TriviaGame {
+	g := newTriviaGame(h.broadcast, h.sendError, h.debug)
+	g.roomGameUpdateSender = h.send
+	g.log = h.log
+	return g
+}
+
+func newTriviaGame(broadcaster func(TriviaStateUpdateMessage), errorSender func(*Player, string), debug bool) *TriviaGame {
+	metrics.gameCreated(InLobby)
 	return &TriviaGame{
 		state:                     InLobby, // team select
 		round:                     0,
 		timer:                     time.NewTimer(DefaultTriviaLimboTime * time.Second),
-		blue:                      make(map[*Player]bool),
-		red:                       make(map[*Player]bool),
-		blueScore:                 0,
-		redScore:                  0,
+		hintTimer:                 newStoppedTimer(),
+		teams:                     newTeams(DefaultTeams),
+		roundVotes:                make(map[*Player]string),
+		bank:                      defaultQuestionBank,
+		asked:                     make(map[*Question]bool),
+		scores:                    make(map[*Player]int),
 		debugMode:                 debug,
 		roundTime:                 DefaultTriviaRoundTime * time.Second,
 		limboTime:                 DefaultTriviaLimboTime * time.Second,
+		wagerTime:                 DefaultWagerTime * time.Second,
 		roomGameUpdateBroadcaster: broadcaster,
+		roomErrorSender:           errorSender,
+		teamAnswer:                TeamAnswerEach,
+		lifelineCounts:            defaultLifelineCounts,
+		lifelinesLeft:             make(map[any]LifelineCounts),
+		overrides:                 make(map[*Player]*questionOverride),
+		log:                       slog.Default(),
 	}
 }
 
+func (t *TriviaGame) configure(settings RoomSettings) {
+	t.setTeamCount(settings.Teams)
+	t.maxTeamSize = settings.MaxTeamSize
+	t.autoAssignTeams = settings.AutoAssignTeams
+	t.rounds = settings.Rounds
+	t.scoring = settings.Scoring
+	t.teamAnswer = settings.TeamAnswer
+	t.lifelineCounts = settings.Lifelines
+	t.draft = settings.CategoryDraft
+}
+
+// checks or assigns teams, then starts the game
+func (t *TriviaGame) start(players []*Player) error {
+	if err := t.prepareTeams(players); err != nil {
+		return err
+	}
+	t.startGame()
+	t.seedScores(players)
+	return nil
+}
+
+// balances teams, or refuses unfair ones when teams aren't auto assigned
+func (t *TriviaGame) prepareTeams(players []*Player) error {
+	if t.freeForAll {
+		return nil
+	}
+	if t.autoAssignTeams {
+		t.balanceTeams(players)
+		return nil
+	}
+	return t.checkTeams(players)
+}
+
+func (t *TriviaGame) handleAction(tgam *TriviaGameActionMessage) {
+	t.actionHandlerWithBroadcast(tgam, nil)
+}
+
+func (t *TriviaGame) handleTimer() {
+	signal := TriviaGameTimerAlert
+	t.actionHandlerWithBroadcast(nil, &signal)
+}
+
+func (t *TriviaGame) timerC() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *TriviaGame) hintTimerC() <-chan time.Time {
+	return t.hintTimer.C
+}
+
+func (t *TriviaGame) roundState() RoundState {
+	return t.state
+}
+
+func (t *TriviaGame) stop() {
+	t.timer.Stop()
+	t.hintTimer.Stop()
+	metrics.gameRemoved(t.state)
+}
+
 // reset and start game
 func (t *TriviaGame) startGame() {
-	t.round = 0
-	t.blueScore = 0
-	t.redScore = 0
-	t.state = InLimbo
+	t.resetGame()
+	t.setState(InLimbo)
 	t.goToRoundFromLimbo()
 }
 
+// clears scores and rounds from the last game
+func (t *TriviaGame) resetGame() {
+	t.round = 0
+	for _, team := range t.teams {
+		team.score = 0
+	}
+	t.scores = make(map[*Player]int)
+	t.asked = make(map[*Question]bool)
+	t.final = false
+	t.wagers = make(map[*Player]int)
+	t.teamWagers = make(map[*Team]int)
+	t.lifelinesLeft = make(map[any]LifelineCounts)
+	t.draftTeam = nil
+	t.draftPicks = nil
+}
+
+// puts every free for all player on the leaderboard, scored or not
+func (t *TriviaGame) seedScores(players []*Player) {
+	if !t.freeForAll {
+		return
+	}
+	for _, p := range players {
+		t.scores[p] = 0
+	}
+}
+
+// stops the clock and goes back to the lobby, for modes that end on their own
+func (t *TriviaGame) endGame() {
+	stopTimer(t.timer)
+	stopTimer(t.hintTimer)
+	t.setState(InLobby)
+	t.log.Info("game over", "rounds", t.round)
+}
+
+// stops a timer and drains a tick that already fired, so a later Reset
+// doesn't go off straight away
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// all state changes go through here so metrics stay in sync
+func (t *TriviaGame) setState(s RoundState) {
+	metrics.gameStateChanged(t.state, s)
+	t.state = s
+}
+
 /*
 Handle incoming player actions and rerouted actions, always runs after the run() cycle
 Only 1 action may execute per call
 Also handles broadcasting after action completed
 */
 func (t *TriviaGame) actionHandlerWithBroadcast(tgam *TriviaGameActionMessage, is *InternalSignal) {
+	// captain elections run in every state
+	if tgam != nil && tgam.Elect != nil {
+		t.elect(tgam.from, *tgam.Elect)
+		return
+	}
+
 	switch t.state {
 	case InLimbo:
-		// timer to switch to round
+		// timer to switch to round, or to wagers after the last regular round
 		if is != nil && *is == TriviaGameTimerAlert {
+			if t.rounds > 0 && t.round >= t.rounds {
+				t.goToWager()
+			} else {
+				t.goToRoundFromLimbo()
+			}
+			t.broadcast(false)
+			return
+		}
+
+		// drafting the next category
+		if tgam != nil && tgam.Category != nil {
+			t.draftCategory(tgam.from, *tgam.Category)
+			return
+		}
+		break
+	case InWager:
+		// timer to show the final question
+		if is != nil && *is == TriviaGameTimerAlert {
+			t.final = true
 			t.goToRoundFromLimbo()
-			t.broadcastGameUpdate(false)
+			t.broadcast(false)
+			return
+		}
+
+		// betting
+		if tgam != nil && tgam.Wager != nil {
+			t.wager(tgam.from, *tgam.Wager)
+			return
+		}
+		break
+	case InReveal:
+		// timer to end the game
+		if is != nil && *is == TriviaGameTimerAlert {
+			t.endGame()
+			t.broadcast(true)
 			return
 		}
 		break
@@ -100,20 +417,43 @@ func (t *TriviaGame) actionHandlerWithBroadcast(tgam *TriviaGameActionMessage, i
 		// timer to switch to limbo
 		if is != nil && *is == TriviaGameTimerAlert {
 			t.goToLimboFromRound()
-			t.broadcastGameUpdate(false)
+			t.broadcast(false)
+			return
+		}
+
+		// guessing
+		if tgam != nil && tgam.Guess != nil {
+			t.guess(tgam.from, *tgam.Guess)
+			return
+		}
+
+		// lifelines
+		if tgam != nil && tgam.Lifeline != nil {
+			t.useLifeline(tgam.from, *tgam.Lifeline)
+			return
 		}
 		break
 	case InLobby:
 		// joining teams
 		if tgam != nil && tgam.Join != nil {
-			if *(tgam.Join) == 0 { // blue
-				t.blue[tgam.from] = true
-				delete(t.red, tgam.from)
-			} else { // red
-				t.red[tgam.from] = true
-				delete(t.blue, tgam.from)
+			if t.freeForAll {
+				t.roomErrorSender(tgam.from, "There are no teams in free for all")
+				return
+			}
+			if *(tgam.Join) < 0 || *(tgam.Join) >= len(t.teams) {
+				t.roomErrorSender(tgam.from, "That team does not exist")
+				return
+			}
+			team := t.teams[*(tgam.Join)]
+			if t.maxTeamSize > 0 && !team.members[tgam.from] && len(team.members) >= t.maxTeamSize {
+				t.roomErrorSender(tgam.from, "That team is full")
+				return
 			}
-			t.broadcastGameUpdate(true)
+			if !team.members[tgam.from] {
+				t.leaveTeam(tgam.from)
+				team.add(tgam.from)
+			}
+			t.broadcast(true)
 			return
 		}
 
@@ -121,19 +461,125 @@ func (t *TriviaGame) actionHandlerWithBroadcast(tgam *TriviaGameActionMessage, i
 	}
 }
 
-// picks a new question from the question bank and sets it as the active question
-func (t *TriviaGame) pickNewQuestion(bank interface{}) {
-	// TODO
+// picks a new question from the question bank and sets it as the active
+// question, from the drafted category when there is one
+func (t *TriviaGame) pickNewQuestion(bank QuestionBank) {
+	var q *Question
+	if category := t.takeDraftPick(); category != "" {
+		q = bank.randomIn(category, t.asked)
+	}
+	if q == nil {
+		q = bank.random(t.asked)
+	}
+	if q == nil {
+		// ran out, start reusing questions
+		t.asked = make(map[*Question]bool)
+		q = bank.random(t.asked)
+	}
+	t.asked[q] = true
+	t.question = q
+}
+
+// records a player's guess, one per round
+func (t *TriviaGame) guess(p *Player, guess string) {
+	_, voted := t.roundVotes[p]
+	if voted && !t.votesCanChange() {
+		t.roomErrorSender(p, "You already answered")
+		return
+	}
+	if !t.freeForAll && t.teamOf(p) == nil {
+		t.roomErrorSender(p, "Pick a team first")
+		return
+	}
+	if t.timeUp(p) {
+		t.roomErrorSender(p, "Time is up")
+		return
+	}
+	if !voted {
+		t.guessOrder = append(t.guessOrder, p)
+	}
+	t.roundVotes[p] = guess
+	t.guessTimes[p] = time.Since(t.roundStart)
+	t.guessHints[p] = t.hints
+	t.sendTeamVotes(p)
+}
+
+// adds up points for the round that just ended
+func (t *TriviaGame) scoreRound() {
+	if t.question == nil {
+		return
+	}
+	if !t.freeForAll && t.teamAnswer != TeamAnswerEach {
+		t.scoreTeamAnswers()
+		return
+	}
+	correct := 0
+	for _, p := range t.guessOrder {
+		if !t.correctGuess(p) {
+			continue
+		}
+		points := t.pointsFor(p) + t.placementBonus(correct)
+		correct++
+		t.roundPoints[p] = points
+		if t.freeForAll {
+			t.scores[p] += points
+		} else if team := t.teamOf(p); team != nil {
+			team.score += points
+		}
+	}
+}
+
+// individual scores, highest first
+func (t *TriviaGame) leaderboard() []LeaderboardEntry {
+	board := []LeaderboardEntry{}
+	for p, score := range t.scores {
+		board = append(board, LeaderboardEntry{Player: p.roomname, Score: score})
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Score != board[j].Score {
+			return board[i].Score > board[j].Score
+		}
+		return board[i].Player < board[j].Player
+	})
+	return board
+}
+
+// forgets everything about a player who left the room
+func (t *TriviaGame) removePlayer(p *Player) {
+	t.leaveTeam(p)
+	delete(t.scores, p)
+	delete(t.roundVotes, p)
+	delete(t.wagers, p)
+	delete(t.overrides, p)
+	delete(t.lifelinesLeft, p)
 }
 
 // starts a new round
 func (t *TriviaGame) goToRoundFromLimbo() {
-	if t.state != InLimbo {
+	if t.state != InLimbo && t.state != InWager {
 		return
 	}
 	t.round++
-	t.state = InRound
+	if t.nextQuestion != nil {
+		t.question = t.nextQuestion()
+	} else {
+		t.pickNewQuestion(t.bank)
+	}
+	t.roundVotes = make(map[*Player]string)
+	t.guessOrder = nil
+	t.guessTimes = make(map[*Player]time.Duration)
+	t.guessHints = make(map[*Player]int)
+	t.roundPoints = make(map[*Player]int)
+	t.overrides = make(map[*Player]*questionOverride)
+	t.setState(InRound)
+	t.roundStart = time.Now()
 	t.timer.Reset(t.roundTime)
+	t.log.Info("round started", "round", t.round)
+	if t.onRoundStart != nil {
+		t.onRoundStart()
+	}
+	// after the hook, modes can change the round time
+	t.scheduleHints()
 }
 
 // enters limbo
@@ -141,33 +587,94 @@ func (t *TriviaGame) goToLimboFromRound() {
 	if t.state != InRound {
 		return
 	}
-	t.state = InLimbo
+	elapsed := time.Since(t.roundStart)
+	metrics.roundFinished(elapsed.Seconds())
+	stopTimer(t.hintTimer)
+	if t.final {
+		t.scoreWagers()
+		t.setState(InReveal)
+		t.timer.Reset(t.limboTime)
+		t.log.Info("final round ended", "round", t.round, "duration", elapsed)
+		return
+	}
+	if t.scorer != nil {
+		t.scorer()
+	} else {
+		t.scoreRound()
+	}
+	t.setState(InLimbo)
 	t.timer.Reset(t.limboTime)
+	t.openDraft()
+	t.log.Info("round ended", "round", t.round, "duration", elapsed)
+	if t.onRoundEnd != nil {
+		t.onRoundEnd()
+	}
 }
 
-func (t *TriviaGame) broadcastGameUpdate(updateTeams bool) {
-	if t.debugMode {
-		return
+// current state, updateTeams includes the team lists
+func (t *TriviaGame) snapshot(updateTeams bool) TriviaStateUpdateMessage {
+	var tsum = TriviaStateUpdateMessage{}
+	// teams carry the scores, so they go out after every round too
+	showScores := updateTeams || t.state == InLimbo || t.state == InWager || t.state == InReveal
+	if !t.freeForAll && showScores {
+		teams := t.teamStates()
+		tsum.Teams = &teams
 	}
 
-	var tsum = TriviaStateUpdateMessage{}
-	if updateTeams {
-		blue := []string{}
-		red := []string{}
-		for p := range t.blue {
-			blue = append(blue, p.roomname)
-		}
-		for p := range t.red {
-			red = append(red, p.roomname)
+	if t.question != nil {
+		switch t.state {
+		case InRound:
+			q := t.question.state()
+			tsum.Question = &q
+		case InLimbo, InReveal:
+			// reveal
+			q := t.question.state()
+			tsum.Question = &q
+			tsum.Answer = &t.question.Answer
 		}
+	}
 
-		tsum.BlueTeam = &blue
-		tsum.RedTeam = &red
+	if t.freeForAll && showScores {
+		board := t.leaderboard()
+		tsum.Leaderboard = &board
 	}
 
 	// set state info
 	tsum.State = int(t.state)
 	tsum.Round = t.round
+	tsum.Mode = TeamsMode
+	if t.freeForAll {
+		tsum.Mode = FreeForAllMode
+	}
+	if t.draft && !t.freeForAll && t.state != InLobby {
+		draft := t.draftState()
+		tsum.Draft = &draft
+	}
+	if t.question != nil && t.hints > 0 && t.state != InLobby {
+		hints := t.question.hints(t.hints)
+		tsum.Hints = &hints
+	}
+	if t.state == InLimbo || t.state == InReveal {
+		answers := t.answerStates()
+		tsum.Answers = &answers
+	}
+	if t.state == InWager || t.final {
+		wagers := t.wagerStates()
+		tsum.Wagers = &wagers
+	}
+	if t.extendSnapshot != nil {
+		t.extendSnapshot(&tsum)
+	}
+	return tsum
+}
 
-	t.roomGameUpdateBroadcaster(tsum)
+func (t *TriviaGame) broadcast(updateTeams bool) {
+	if t.debugMode {
+		return
+	}
+	t.roomGameUpdateBroadcaster(t.snapshot(updateTeams))
+	// players with lifelines in play see their own version of the round
+	for p := range t.overrides {
+		t.sendSnapshotTo(p, updateTeams)
+	}
 }
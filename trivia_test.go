@@ -1 +1,587 @@
 package main
+
+import (
+	"testing"
+	"time"
+)
+
+// one question bank so tests know the answer
+var testQuestion = &Question{Prompt: "2 + 2?", Options: []string{"3", "4"}, Answer: "4", Category: "Math", Difficulty: 1}
+
+func newTestGame() *TriviaGame {
+	g := newTriviaGame(func(TriviaStateUpdateMessage) {}, func(*Player, string) {}, true)
+	g.bank = &staticQuestionBank{questions: []*Question{testQuestion}}
+	return g
+}
+
+// tgam as sent by p
+func action(p *Player, tgam TriviaGameActionMessage) *TriviaGameActionMessage {
+	tgam.from = p
+	return &tgam
+}
+
+func TestTeamScoring(t *testing.T) {
+	g := newTestGame()
+	pl0, pl1, pl2 := &Player{}, &Player{}, &Player{}
+	g.teams[0].members[pl0] = true
+	g.teams[0].members[pl1] = true
+	g.teams[1].members[pl2] = true
+	g.startGame()
+
+	g.actionHandlerWithBroadcast(action(pl0, TriviaGameActionMessage{Guess: ptr("4")}), nil)
+	g.actionHandlerWithBroadcast(action(pl1, TriviaGameActionMessage{Guess: ptr(" 4 ")}), nil)
+	g.actionHandlerWithBroadcast(action(pl2, TriviaGameActionMessage{Guess: ptr("3")}), nil)
+	g.actionHandlerWithBroadcast(action(pl2, TriviaGameActionMessage{Guess: ptr("4")}), nil) // second guess ignored
+	g.goToLimboFromRound()
+
+	if g.teams[0].score != 2*CorrectAnswerPoints || g.teams[1].score != 0 {
+		t.Fatalf("Unexpected team scores %d and %d", g.teams[0].score, g.teams[1].score)
+	}
+}
+
+func TestFreeForAllScoring(t *testing.T) {
+	g := newTestGame()
+	g.freeForAll = true
+	fast, slow, wrong := &Player{roomname: "fast"}, &Player{roomname: "slow"}, &Player{roomname: "wrong"}
+	g.start([]*Player{fast, slow, wrong})
+
+	g.actionHandlerWithBroadcast(action(wrong, TriviaGameActionMessage{Guess: ptr("3")}), nil)
+	g.actionHandlerWithBroadcast(action(fast, TriviaGameActionMessage{Guess: ptr("4")}), nil)
+	g.actionHandlerWithBroadcast(action(slow, TriviaGameActionMessage{Guess: ptr("4")}), nil)
+	g.goToLimboFromRound()
+
+	board := g.leaderboard()
+	if len(board) != 3 || board[0].Player != "fast" || board[0].Score <= board[1].Score {
+		t.Fatalf("Faster correct answer should lead the leaderboard, got %+v", board)
+	}
+	if board[2].Player != "wrong" || board[2].Score != 0 {
+		t.Fatalf("Players without points should still be listed, got %+v", board)
+	}
+}
+
+func TestBuzzer(t *testing.T) {
+	b := newBuzzerGame(newTestGame())
+	pl0, pl1, pl2 := &Player{roomname: "pl0"}, &Player{roomname: "pl1"}, &Player{roomname: "pl2"}
+	b.teams[0].members[pl0] = true
+	b.teams[0].members[pl1] = true
+	b.teams[1].members[pl2] = true
+	b.startGame()
+
+	b.handleAction(action(pl2, TriviaGameActionMessage{Guess: ptr("4")}))
+	if len(b.roundVotes) != 0 {
+		t.Fatal("Guess without buzzing in should be refused")
+	}
+
+	b.handleAction(action(pl0, TriviaGameActionMessage{Buzz: ptr(true)}))
+	b.handleAction(action(pl2, TriviaGameActionMessage{Buzz: ptr(true)}))
+	if b.answering != pl0 {
+		t.Fatal("First buzz should hold the answer window")
+	}
+
+	// wrong answer locks out the whole team and reopens the question
+	b.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("3")}))
+	if !b.lockedOut[pl1] || b.answering != nil || b.state != InRound {
+		t.Fatal("Wrong answer should lock out the team and reopen the question")
+	}
+	b.handleAction(action(pl1, TriviaGameActionMessage{Buzz: ptr(true)}))
+	if b.answering != nil {
+		t.Fatal("Locked out player should not be able to buzz")
+	}
+
+	b.handleAction(action(pl2, TriviaGameActionMessage{Buzz: ptr(true)}))
+	b.handleAction(action(pl2, TriviaGameActionMessage{Guess: ptr("4")}))
+	if b.state != InLimbo || b.teams[1].score != CorrectAnswerPoints || b.teams[0].score != 0 {
+		t.Fatalf("Correct answer should end the round, scores %d and %d", b.teams[0].score, b.teams[1].score)
+	}
+
+	snap := b.snapshot(false)
+	if snap.Buzzer == nil || len(snap.Buzzer.Order) != 2 || snap.Mode != BuzzerMode {
+		t.Fatalf("Unexpected buzzer state %+v", snap.Buzzer)
+	}
+}
+
+func TestBuzzerCaptain(t *testing.T) {
+	b := newBuzzerGame(newTestGame())
+	b.teamAnswer = TeamAnswerCaptain
+	captain, pl1 := &Player{roomname: "captain"}, &Player{roomname: "pl1"}
+	b.teams[0].add(captain)
+	b.teams[0].add(pl1)
+	b.startGame()
+
+	b.handleAction(action(pl1, TriviaGameActionMessage{Buzz: ptr(true)}))
+	if b.answering != nil {
+		t.Fatal("Only the captain should be able to buzz")
+	}
+	b.handleAction(action(captain, TriviaGameActionMessage{Buzz: ptr(true)}))
+	b.handleAction(action(captain, TriviaGameActionMessage{Guess: ptr("4")}))
+	if b.state != InLimbo || b.teams[0].score != CorrectAnswerPoints {
+		t.Fatalf("Captain's answer should score for the team, got %d", b.teams[0].score)
+	}
+}
+
+func TestBuzzerExtraTime(t *testing.T) {
+	b := newBuzzerGame(newTestGame())
+	b.lifelineCounts = LifelineCounts{ExtraTime: 1}
+	pl0, pl1 := &Player{}, &Player{}
+	b.teams[0].add(pl0)
+	b.teams[1].add(pl1)
+	b.startGame()
+	b.handleAction(action(pl1, TriviaGameActionMessage{Lifeline: ptr(LifelineExtraTime)}))
+
+	b.handleAction(action(pl0, TriviaGameActionMessage{Buzz: ptr(true)}))
+	if b.remaining <= b.roundTime {
+		t.Fatalf("Answer window should keep the extra time, %v left", b.remaining)
+	}
+	b.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("3")}))
+	if left := time.Until(b.deadlineFor(pl1)); b.state != InRound || left <= b.roundTime {
+		t.Fatalf("Reopened question should keep the extra time, %v left", left)
+	}
+}
+
+func TestElimination(t *testing.T) {
+	spectating, eliminated := map[*Player]bool{}, map[*Player]bool{}
+	e := newEliminationGame(newTestGame(), func(p *Player, spectate bool) {
+		spectating[p] = spectate
+		eliminated[p] = eliminated[p] || spectate
+	})
+	pl0, pl1, pl2 := &Player{roomname: "pl0"}, &Player{roomname: "pl1"}, &Player{roomname: "pl2"}
+	if err := e.start([]*Player{pl0}); err == nil {
+		t.Fatal("Elimination should not start with one player")
+	}
+	if err := e.start([]*Player{pl0, pl1, pl2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// wrong and missing answers are both out
+	e.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("4")}))
+	e.handleAction(action(pl1, TriviaGameActionMessage{Guess: ptr("3")}))
+	e.goToLimboFromRound()
+	if !e.alive[pl0] || e.alive[pl1] || e.alive[pl2] || !eliminated[pl1] || !eliminated[pl2] {
+		t.Fatalf("Unexpected survivors %v", e.alive)
+	}
+	if e.state != InLobby || e.winner != pl0 {
+		t.Fatal("Last player standing should win and end the game")
+	}
+	if spectating[pl1] || spectating[pl2] {
+		t.Fatal("Eliminated players should play again after the game")
+	}
+	snap := e.snapshot(false)
+	if snap.Winner == nil || *snap.Winner != "pl0" || snap.Alive == nil || len(*snap.Alive) != 3 {
+		t.Fatalf("Unexpected elimination state %+v", snap)
+	}
+}
+
+func TestEliminationRoundsGetShorter(t *testing.T) {
+	e := newEliminationGame(newTestGame(), func(*Player, bool) {})
+	pl0, pl1 := &Player{}, &Player{}
+	e.start([]*Player{pl0, pl1})
+	first := e.roundTime
+
+	// nobody right, nobody out
+	e.goToLimboFromRound()
+	e.goToRoundFromLimbo()
+	if len(e.alive) != 2 || e.roundTime >= first {
+		t.Fatalf("Expected both alive and a shorter round, got %d alive and %v", len(e.alive), e.roundTime)
+	}
+}
+
+func TestBoard(t *testing.T) {
+	g := newTestGame()
+	hard := &Question{Prompt: "3 * 3?", Options: []string{"6", "9"}, Answer: "9", Category: "Math", Difficulty: 2}
+	g.bank = &staticQuestionBank{questions: []*Question{testQuestion, hard}}
+	b := newBoardGame(g)
+	pl0, pl1 := &Player{}, &Player{}
+	b.teams[0].members[pl0] = true
+	b.teams[1].members[pl1] = true
+	if err := b.start([]*Player{pl0, pl1}); err != nil {
+		t.Fatal(err)
+	}
+	if b.state != InLimbo || b.cellsLeft() != 2 {
+		t.Fatalf("Expected a board with two questions in limbo, got %d", b.cellsLeft())
+	}
+
+	b.handleAction(action(pl1, TriviaGameActionMessage{Pick: &BoardPick{Category: "Math", Value: 200}}))
+	if b.state != InLimbo {
+		t.Fatal("Only the controlling team should pick")
+	}
+	b.handleAction(action(pl0, TriviaGameActionMessage{Pick: &BoardPick{Category: "Math", Value: 200}}))
+	if b.question != hard {
+		t.Fatal("Pick should start the round with the picked question")
+	}
+
+	// wrong answers cost points, the first team right takes control
+	b.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("6")}))
+	b.handleAction(action(pl1, TriviaGameActionMessage{Guess: ptr("9")}))
+	b.goToLimboFromRound()
+	if b.teams[0].score != -200 || b.teams[1].score != 200 || b.control != 1 {
+		t.Fatalf("Unexpected scores %d and %d, control %d", b.teams[0].score, b.teams[1].score, b.control)
+	}
+
+	// nobody picks in time, the last question is played and the game ends
+	b.handleTimer()
+	if b.question != testQuestion {
+		t.Fatal("Expected the remaining question when nobody picked")
+	}
+	// hints cost points on the board too
+	b.hints = 1
+	b.handleAction(action(pl1, TriviaGameActionMessage{Guess: ptr("4")}))
+	b.goToLimboFromRound()
+	if b.teams[1].score != 200+100-HintPenalty {
+		t.Fatalf("Hint should cost points, got %d", b.teams[1].score)
+	}
+	if b.state != InLobby {
+		t.Fatal("Game should end once the board is empty")
+	}
+}
+
+func TestBoardTeamAnswers(t *testing.T) {
+	for _, mode := range []string{TeamAnswerCaptain, TeamAnswerMajority} {
+		g := newTestGame()
+		g.teamAnswer = mode
+		b := newBoardGame(g)
+		pl0, pl1, pl2, pl3, pl4 := &Player{}, &Player{}, &Player{}, &Player{}, &Player{}
+		b.teams[0].add(pl0)
+		b.teams[0].add(pl1)
+		b.teams[0].add(pl2)
+		b.teams[1].add(pl3)
+		b.teams[1].add(pl4)
+		if err := b.start([]*Player{pl0, pl1, pl2, pl3, pl4}); err != nil {
+			t.Fatal(err)
+		}
+		b.handleAction(action(pl0, TriviaGameActionMessage{Pick: &BoardPick{Category: "Math", Value: 100}}))
+
+		// a teammate's wrong answer comes first but the team answer is right
+		b.handleAction(action(pl1, TriviaGameActionMessage{Guess: ptr("3")}))
+		b.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("4")}))
+		b.handleAction(action(pl2, TriviaGameActionMessage{Guess: ptr("4")}))
+		b.goToLimboFromRound()
+		if b.teams[0].score != 100 {
+			t.Errorf("%s: team answer should win the question, got %d", mode, b.teams[0].score)
+		}
+	}
+}
+
+func TestFinalWager(t *testing.T) {
+	g := newTestGame()
+	g.rounds = 1
+	pl0, pl1 := &Player{}, &Player{}
+	g.teams[0].members[pl0] = true
+	g.teams[1].members[pl1] = true
+	g.startGame()
+	g.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("4")}))
+	g.goToLimboFromRound()
+
+	// last regular round is over, betting opens instead of another round
+	g.handleTimer()
+	if g.state != InWager {
+		t.Fatalf("Expected wagers after the last round, got %s", g.state)
+	}
+	g.handleAction(action(pl1, TriviaGameActionMessage{Wager: ptr(50)}))
+	g.handleAction(action(pl0, TriviaGameActionMessage{Wager: ptr(CorrectAnswerPoints + 1)}))
+	if len(g.teamWagers) != 0 {
+		t.Fatal("Wagers over the score should be refused")
+	}
+	g.handleAction(action(pl0, TriviaGameActionMessage{Wager: ptr(60)}))
+	if snap := g.snapshot(false); snap.Question != nil || (*snap.Wagers)[0].Amount != nil || !(*snap.Wagers)[0].Wagered {
+		t.Fatal("Wagers and the question should stay hidden while betting")
+	}
+
+	g.handleTimer()
+	if g.state != InRound || !g.final {
+		t.Fatal("Expected the final round after wagers")
+	}
+	g.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("3")}))
+	g.goToLimboFromRound()
+	if g.state != InReveal || g.teams[0].score != CorrectAnswerPoints-60 || g.teams[1].score != 0 {
+		t.Fatalf("Unexpected final scores %d and %d", g.teams[0].score, g.teams[1].score)
+	}
+	if snap := g.snapshot(false); (*snap.Wagers)[0].Amount == nil || *(*snap.Wagers)[0].Amount != 60 {
+		t.Fatal("Wagers should show on reveal")
+	}
+
+	g.handleTimer()
+	if g.state != InLobby {
+		t.Fatal("Game should end after the reveal")
+	}
+}
+
+func TestFinalWagerCaptain(t *testing.T) {
+	g := newTestGame()
+	g.rounds = 1
+	g.teamAnswer = TeamAnswerCaptain
+	captain, pl1 := &Player{}, &Player{}
+	g.teams[0].add(captain)
+	g.teams[0].add(pl1)
+	g.startGame()
+	g.teams[0].score = CorrectAnswerPoints
+	g.goToLimboFromRound()
+	g.handleTimer()
+	g.handleAction(action(captain, TriviaGameActionMessage{Wager: ptr(50)}))
+	g.handleTimer()
+
+	// a teammate answers first but the captain's answer is the one that counts
+	g.handleAction(action(pl1, TriviaGameActionMessage{Guess: ptr("4")}))
+	g.handleAction(action(captain, TriviaGameActionMessage{Guess: ptr("3")}))
+	g.goToLimboFromRound()
+	if g.teams[0].score != CorrectAnswerPoints-50 {
+		t.Fatalf("Captain's wrong answer should lose the wager, got %d", g.teams[0].score)
+	}
+}
+
+func TestScoringFormulas(t *testing.T) {
+	round := 10 * time.Second
+	cases := []struct {
+		scoring string
+		elapsed time.Duration
+		points  int
+	}{
+		{ScoringFlat, time.Second, CorrectAnswerPoints},
+		{ScoringLinear, 0, CorrectAnswerPoints + LinearSpeedBonus},
+		{ScoringLinear, 5 * time.Second, CorrectAnswerPoints + LinearSpeedBonus/2},
+		{ScoringLinear, round, CorrectAnswerPoints},
+		{ScoringTiered, time.Second, CorrectAnswerPoints + 50},
+		{ScoringTiered, 6 * time.Second, CorrectAnswerPoints + 10},
+		{ScoringTiered, 9 * time.Second, CorrectAnswerPoints},
+	}
+	g := newTestGame()
+	g.roundTime = round
+	for _, c := range cases {
+		g.scoring = c.scoring
+		if points := g.answerPoints(c.elapsed); points != c.points {
+			t.Errorf("%s at %v: expected %d points, got %d", c.scoring, c.elapsed, c.points, points)
+		}
+	}
+}
+
+func TestAnswerBreakdown(t *testing.T) {
+	g := newTestGame()
+	g.freeForAll = true
+	pl0, pl1 := &Player{roomname: "pl0"}, &Player{roomname: "pl1"}
+	g.startGame()
+	g.handleAction(action(pl1, TriviaGameActionMessage{Guess: ptr("4")}))
+	g.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("3")}))
+	g.guessTimes[pl1] = 3 * time.Second
+	g.guessTimes[pl0] = time.Second
+	g.goToLimboFromRound()
+
+	answers := *g.snapshot(false).Answers
+	if len(answers) != 2 || answers[0].Player != "pl0" || answers[0].Correct || answers[1].TimeMs != 3000 ||
+		answers[1].Points != CorrectAnswerPoints+speedBonus[0] {
+		t.Fatalf("Unexpected answer breakdown %+v", answers)
+	}
+}
+
+func TestTeamAnswerModes(t *testing.T) {
+	cases := []struct {
+		mode  string
+		votes []string // by pl0, pl1, pl2 on one team, in that order
+		right bool
+	}{
+		{TeamAnswerMajority, []string{"3", "4", "4"}, true},
+		{TeamAnswerMajority, []string{"3", "4", "3"}, false},
+		{TeamAnswerMajority, []string{"4", "3", ""}, true}, // tie goes to the earliest vote
+		{TeamAnswerCaptain, []string{"3", "4", "4"}, false},
+		{TeamAnswerCaptain, []string{"4", "3", "3"}, true},
+		{TeamAnswerAny, []string{"3", "3", "4"}, true},
+		{TeamAnswerAny, []string{"3", "3", "3"}, false},
+	}
+	for _, c := range cases {
+		g := newTestGame()
+		g.teamAnswer = c.mode
+		players := []*Player{{}, {}, {}}
+		for _, p := range players {
+			g.teams[0].add(p)
+		}
+		g.startGame()
+		for i, v := range c.votes {
+			if v != "" {
+				g.handleAction(action(players[i], TriviaGameActionMessage{Guess: ptr(v)}))
+				g.guessTimes[players[i]] = time.Duration(i) * time.Second
+			}
+		}
+		g.goToLimboFromRound()
+		if right := g.teams[0].score == CorrectAnswerPoints; right != c.right {
+			t.Errorf("%s with votes %v: expected right %v, got score %d", c.mode, c.votes, c.right, g.teams[0].score)
+		}
+	}
+}
+
+func TestTeamVotesStayOnTheTeam(t *testing.T) {
+	g := newTestGame()
+	g.debugMode = false
+	g.teamAnswer = TeamAnswerMajority
+	g.lifelineCounts = LifelineCounts{ExtraTime: 1}
+	sent := map[*Player]int{}
+	roundTimes := map[*Player]int{}
+	g.roomGameUpdateSender = func(p *Player, tsum TriviaStateUpdateMessage) {
+		if tsum.TeamVotes != nil {
+			sent[p]++
+			roundTimes[p] = *tsum.RoundTime
+		}
+	}
+	pl0, pl1, pl2 := &Player{}, &Player{}, &Player{}
+	g.teams[0].add(pl0)
+	g.teams[0].add(pl1)
+	g.teams[1].add(pl2)
+	g.startGame()
+	g.handleAction(action(pl0, TriviaGameActionMessage{Lifeline: ptr(LifelineExtraTime)}))
+
+	g.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("3")}))
+	g.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("4")})) // votes can change
+	if sent[pl0] != 2 || sent[pl1] != 2 || sent[pl2] != 0 {
+		t.Fatalf("Team votes should only go to the team, got %v", sent)
+	}
+	if roundTimes[pl1] != int((g.roundTime + ExtraTimeLifeline).Seconds()) {
+		t.Fatalf("Team votes should keep the extra time, got %d", roundTimes[pl1])
+	}
+	if g.roundVotes[pl0] != "4" {
+		t.Fatal("Changed vote should replace the old one")
+	}
+}
+
+func TestLifelines(t *testing.T) {
+	g := newTestGame()
+	wide := &Question{Prompt: "1 + 1?", Options: []string{"1", "2", "3", "4"}, Answer: "2", Category: "Math", Difficulty: 1}
+	g.bank = &staticQuestionBank{questions: []*Question{wide, testQuestion}}
+	g.lifelineCounts = LifelineCounts{FiftyFifty: 1, Skip: 1, ExtraTime: 1}
+	pl0, pl1, pl2 := &Player{}, &Player{}, &Player{}
+	g.teams[0].add(pl0)
+	g.teams[0].add(pl1)
+	g.teams[1].add(pl2)
+	g.startGame()
+	g.question = wide
+	g.asked = map[*Question]bool{wide: true}
+
+	// 50/50 only changes the round for the team that used it
+	g.handleAction(action(pl0, TriviaGameActionMessage{Lifeline: ptr(LifelineFiftyFifty)}))
+	if o := g.overrides[pl1]; o == nil || len(o.options) != 2 || g.overrides[pl2] != nil {
+		t.Fatal("50/50 should leave two options for the team only")
+	}
+	g.handleAction(action(pl1, TriviaGameActionMessage{Lifeline: ptr(LifelineFiftyFifty)}))
+	if g.lifelinesLeft[g.teams[0]].FiftyFifty != 0 {
+		t.Fatal("Lifeline should be used up")
+	}
+
+	// skip swaps the team's question and its old votes
+	g.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("2")}))
+	g.handleAction(action(pl0, TriviaGameActionMessage{Lifeline: ptr(LifelineSkip)}))
+	if g.questionFor(pl1) != testQuestion || g.questionFor(pl2) != wide || len(g.roundVotes) != 0 {
+		t.Fatal("Skip should give the team another question")
+	}
+
+	// extra time pushes back the team's deadline only
+	g.handleAction(action(pl0, TriviaGameActionMessage{Lifeline: ptr(LifelineExtraTime)}))
+	if !g.deadlineFor(pl0).After(g.deadlineFor(pl2)) {
+		t.Fatal("Extra time should extend the team's deadline")
+	}
+
+	g.handleAction(action(pl0, TriviaGameActionMessage{Guess: ptr("4")}))
+	g.handleAction(action(pl2, TriviaGameActionMessage{Guess: ptr("2")}))
+	g.goToLimboFromRound()
+	if g.teams[0].score != CorrectAnswerPoints || g.teams[1].score != CorrectAnswerPoints {
+		t.Fatalf("Each team should be scored on its own question, got %d and %d", g.teams[0].score, g.teams[1].score)
+	}
+}
+
+func TestHints(t *testing.T) {
+	g := newTestGame()
+	freeText := &Question{Prompt: "Capital of Italy?", Answer: "Rome", Category: "Geography", Difficulty: 3}
+	g.bank = &staticQuestionBank{questions: []*Question{freeText}}
+	fast, slow := &Player{}, &Player{}
+	g.teams[0].add(fast)
+	g.teams[1].add(slow)
+	g.startGame()
+
+	g.handleAction(action(fast, TriviaGameActionMessage{Guess: ptr("rome")}))
+	g.handleHintTimer()
+	g.handleHintTimer()
+	hints := *g.snapshot(false).Hints
+	if len(hints) != 2 || hints[1] != "The answer has 4 letters" {
+		t.Fatalf("Unexpected hints %v", hints)
+	}
+	g.handleAction(action(slow, TriviaGameActionMessage{Guess: ptr("Rome")}))
+	g.goToLimboFromRound()
+	if g.teams[0].score != CorrectAnswerPoints || g.teams[1].score != CorrectAnswerPoints-2*HintPenalty {
+		t.Fatalf("Hints should cost points, got %d and %d", g.teams[0].score, g.teams[1].score)
+	}
+
+	// multiple choice questions don't get hints
+	g.bank = &staticQuestionBank{questions: []*Question{testQuestion}}
+	g.goToRoundFromLimbo()
+	if g.hintTimer.Stop() {
+		t.Fatal("Hint timer should not run for multiple choice questions")
+	}
+}
+
+func TestCategoryDraft(t *testing.T) {
+	g := newTestGame()
+	history := &Question{Prompt: "Year 1066 battle?", Options: []string{"Hastings", "Agincourt"}, Answer: "Hastings", Category: "History", Difficulty: 1}
+	g.bank = &staticQuestionBank{questions: []*Question{testQuestion, history}}
+	g.draft = true
+	pl0, pl1 := &Player{}, &Player{}
+	g.teams[0].add(pl0)
+	g.teams[1].add(pl1)
+	g.startGame()
+	g.question = testQuestion
+	g.asked = map[*Question]bool{testQuestion: true}
+	g.goToLimboFromRound()
+
+	if g.draftTeam != g.teams[0] || len(g.draftOffer) != 2 {
+		t.Fatal("First team should draft from the offered categories")
+	}
+	g.handleAction(action(pl1, TriviaGameActionMessage{Category: ptr("History")}))
+	if g.draftPick != "" {
+		t.Fatal("Only the drafting team should pick")
+	}
+	g.handleAction(action(pl0, TriviaGameActionMessage{Category: ptr("History")}))
+	g.handleTimer()
+	if g.question != history {
+		t.Fatal("Next question should come from the drafted category")
+	}
+
+	// second team's turn, nobody picks so the first offer is used
+	g.goToLimboFromRound()
+	if g.draftTeam != g.teams[1] {
+		t.Fatal("Teams should take turns drafting")
+	}
+	offered := g.draftOffer[0]
+	g.handleTimer()
+	draft := g.snapshot(false).Draft
+	if len(draft.Picks) != 2 || draft.Picks[1].Category != offered || draft.Picks[1].Team != g.teams[1].name {
+		t.Fatalf("Unexpected draft picks %+v", draft.Picks)
+	}
+}
+
+func TestBalanceThreeTeams(t *testing.T) {
+	g := newTestGame()
+	g.setTeamCount(3)
+	players := []*Player{{}, {}, {}, {}, {}, {}}
+	for i, p := range players {
+		g.teams[i%2].add(p)
+	}
+	g.balanceTeams(players)
+	for _, team := range g.teams {
+		if len(team.members) != 2 {
+			t.Fatalf("Expected 2/2/2 after balancing 3/3/0, got %v", g.teamStates())
+		}
+	}
+	if err := g.checkTeams(players); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShuffleRespectsTeamSize(t *testing.T) {
+	g := newTestGame()
+	g.maxTeamSize = 2
+	players := []*Player{{}, {}, {}, {}, {}, {}}
+	g.shuffleTeams(players)
+	unassigned := 0
+	for _, p := range players {
+		if g.teamOf(p) == nil {
+			unassigned++
+		}
+	}
+	if len(g.teams[0].members) != 2 || len(g.teams[1].members) != 2 || unassigned != 2 {
+		t.Fatalf("Expected 2/2 with 2 left over, got %v", g.teamStates())
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sort"
+)
+
+// outgoing, a team's or player's final round bet
+type WagerState struct {
+	Name    string `json:"name"`
+	Wagered bool   `json:"wagered"`
+
+	// hidden until the reveal
+	Amount *int `json:"amount"`
+}
+
+// opens betting on the final round, the question stays hidden until it's over
+func (t *TriviaGame) goToWager() {
+	if t.state != InLimbo {
+		return
+	}
+	t.wagers = make(map[*Player]int)
+	t.teamWagers = make(map[*Team]int)
+	t.setState(InWager)
+	t.timer.Reset(t.wagerTime)
+	t.log.Info("wagers open", "round", t.round)
+}
+
+// records a bet, anyone on a team can change the team's bet until time runs out
+func (t *TriviaGame) wager(p *Player, amount int) {
+	if amount < 0 {
+		t.roomErrorSender(p, "Wagers can't be negative")
+		return
+	}
+	if t.freeForAll {
+		if amount > max(t.scores[p], 0) {
+			t.roomErrorSender(p, "You can't wager more than your score")
+			return
+		}
+		t.wagers[p] = amount
+	} else {
+		team := t.teamOf(p)
+		if team == nil {
+			t.roomErrorSender(p, "Pick a team first")
+			return
+		}
+		if amount > max(team.score, 0) {
+			t.roomErrorSender(p, "You can't wager more than your team's score")
+			return
+		}
+		t.teamWagers[team] = amount
+	}
+	t.broadcast(false)
+}
+
+// right answers win the bet and wrong or missing ones lose it. a team's first
+// answer is the one that counts unless the team answer mode picks another
+func (t *TriviaGame) scoreWagers() {
+	if t.freeForAll {
+		for p, amount := range t.wagers {
+			if t.correctGuess(p) {
+				t.roundPoints[p] = amount
+			} else {
+				t.roundPoints[p] = -amount
+			}
+			t.scores[p] += t.roundPoints[p]
+		}
+		return
+	}
+	answered := make(map[*Team]*Player)
+	for _, p := range t.guessOrder {
+		if team := t.teamOf(p); team != nil && answered[team] == nil {
+			answered[team] = p
+		}
+	}
+	for team, amount := range t.teamWagers {
+		p := answered[team]
+		if t.teamAnswer != TeamAnswerEach {
+			p = t.teamAnswerOf(team)
+		}
+		if p != nil && t.correctGuess(p) {
+			team.score += amount
+		} else {
+			team.score -= amount
+			amount = -amount
+		}
+		if p != nil {
+			t.roundPoints[p] = amount
+		}
+	}
+}
+
+func (t *TriviaGame) wagerStates() []WagerState {
+	states := []WagerState{}
+	add := func(name string, amount int, wagered bool) {
+		ws := WagerState{Name: name, Wagered: wagered}
+		if wagered && t.state == InReveal {
+			ws.Amount = &amount
+		}
+		states = append(states, ws)
+	}
+	if !t.freeForAll {
+		for _, team := range t.teams {
+			amount, wagered := t.teamWagers[team]
+			add(team.name, amount, wagered)
+		}
+		return states
+	}
+	players := []*Player{}
+	for p := range t.scores {
+		players = append(players, p)
+	}
+	for p := range t.wagers {
+		if _, in := t.scores[p]; !in {
+			players = append(players, p)
+		}
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].roomname < players[j].roomname })
+	for _, p := range players {
+		amount, wagered := t.wagers[p]
+		add(p.roomname, amount, wagered)
+	}
+	return states
+}